@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// dataFlags are the flags selecting the data of a render: -d sources merged
+// in order, then --set overrides.
+type dataFlags struct {
+	sources listFlag
+	sets    listFlag
+	lists   string
+}
+
+func (f *dataFlags) register(fs *flag.FlagSet) {
+	fs.Var(&f.sources, "d", "data `source`, repeatable: a .json, .yaml, .toml or .env file, - for JSON on standard input,\n"+
+		"format:file (e.g. yaml:-) to name the format, or env:PREFIX for the environment variables starting with PREFIX")
+	fs.Var(&f.sets, "set", "override a value by dotted `name=value`, repeatable; JSON values are decoded, anything else is a string")
+	fs.StringVar(&f.lists, "merge-lists", "replace", "how later sources merge into lists: replace, append or index")
+}
+
+// stdinSources returns the number of sources reading standard input.
+func (f *dataFlags) stdinSources() int {
+	n := 0
+	for _, s := range f.sources {
+		if src, err := parseSource(s); err == nil && src.format != "env" && src.path == "-" {
+			n++
+		}
+	}
+	return n
+}
+
+// load reads and merges the data sources and applies the overrides. It
+// returns nil if there are neither.
+func (f *dataFlags) load(stdin io.Reader) (any, error) {
+	merge, ok := listMerges[f.lists]
+	if !ok {
+		return nil, usageError{fmt.Sprintf("unknown list merge strategy %q", f.lists)}
+	}
+	var data any
+	for _, s := range f.sources {
+		src, err := parseSource(s)
+		if err != nil {
+			return nil, err
+		}
+		v, err := src.load(stdin)
+		if err != nil {
+			return nil, err
+		}
+		data = mergeValues(data, v, merge)
+	}
+	for _, s := range f.sets {
+		name, raw, ok := strings.Cut(s, "=")
+		if !ok || name == "" {
+			return nil, usageError{fmt.Sprintf("--set %q: want name=value", s)}
+		}
+		var err error
+		if data, err = setValue(data, strings.Split(name, "."), parseValue(raw)); err != nil {
+			return nil, fmt.Errorf("--set %s: %w", name, err)
+		}
+	}
+	return data, nil
+}
+
+// listFlag is a flag that may be given several times.
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ", ") }
+func (l *listFlag) Set(s string) error { *l = append(*l, s); return nil }
+
+// source is one -d argument.
+type source struct {
+	format string // json, yaml, toml, dotenv or env
+	path   string // file name, "-" for standard input, or the prefix for env
+}
+
+var formatsByExt = map[string]string{
+	".json": "json",
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".toml": "toml",
+	".env":  "dotenv",
+}
+
+func parseSource(s string) (source, error) {
+	if format, path, ok := strings.Cut(s, ":"); ok {
+		switch format {
+		case "json", "yaml", "toml", "dotenv", "env":
+			return source{format, path}, nil
+		}
+	}
+	if s == "-" {
+		return source{"json", s}, nil
+	}
+	if format, ok := formatsByExt[strings.ToLower(filepath.Ext(s))]; ok {
+		return source{format, s}, nil
+	}
+	return source{}, usageError{fmt.Sprintf("-d %s: unknown data format; use a known extension or prefix it with json:, yaml:, toml: or dotenv:", s)}
+}
+
+func (s source) load(stdin io.Reader) (any, error) {
+	if s.format == "env" {
+		return envData(os.Environ(), s.path), nil
+	}
+	b, err := readInput(s.path, stdin)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	switch s.format {
+	case "json":
+		v, err = decodeJSON(b)
+	case "yaml":
+		err = yaml.Unmarshal(b, &v)
+	case "toml":
+		var m map[string]any
+		_, err = toml.Decode(string(b), &m)
+		v = m
+	case "dotenv":
+		v, err = decodeDotenv(b)
+	}
+	var serr *syntaxError
+	if errors.As(err, &serr) {
+		return nil, fmt.Errorf("%s:%w", s.path, err)
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+	return normalize(v), nil
+}
+
+// syntaxError is a JSON syntax error with its line and column.
+type syntaxError struct {
+	line, col int
+	err       error
+}
+
+func (e *syntaxError) Error() string { return fmt.Sprintf("%d:%d: %v", e.line, e.col, e.err) }
+func (e *syntaxError) Unwrap() error { return e.err }
+
+// decodeJSON decodes a JSON document, keeping numbers as written and
+// locating syntax errors.
+func decodeJSON(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		var serr *json.SyntaxError
+		if errors.As(err, &serr) {
+			// Offset is just past the offending byte.
+			line, col := lineCol(b, int(serr.Offset)-1)
+			return nil, &syntaxError{line, col, err}
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// lineCol returns the 1-based line and column of the byte offset in b.
+func lineCol(b []byte, offset int) (int, int) {
+	offset = max(0, min(offset, len(b)))
+	line := bytes.Count(b[:offset], []byte("\n")) + 1
+	col := offset - bytes.LastIndexByte(b[:offset], '\n')
+	return line, col
+}
+
+// decodeDotenv parses KEY=value lines. Values may be single-quoted
+// (literally) or double-quoted (with \n, \t, \" and \\ escapes); unquoted
+// values end at a " #" comment. Keys are nested like environment variables.
+func decodeDotenv(b []byte) (any, error) {
+	var vars []string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, val, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%d: want KEY=value", n)
+		}
+		val = strings.TrimSpace(val)
+		switch {
+		case len(val) >= 2 && val[0] == '\'' && val[len(val)-1] == '\'':
+			val = val[1 : len(val)-1]
+		case len(val) >= 2 && val[0] == '"' && val[len(val)-1] == '"':
+			val = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(val[1 : len(val)-1])
+		default:
+			if i := strings.Index(val, " #"); i >= 0 {
+				val = strings.TrimSpace(val[:i])
+			}
+		}
+		vars = append(vars, key+"="+val)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return envData(vars, ""), nil
+}
+
+// envData turns the KEY=value pairs starting with prefix into a map, with
+// the prefix removed. A double underscore nests, so APP_DB__HOST with
+// prefix APP_ is {{DB.HOST}}.
+func envData(vars []string, prefix string) any {
+	data := make(map[string]any)
+	for _, kv := range vars {
+		key, val, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(key, prefix) || len(key) == len(prefix) {
+			continue
+		}
+		m := data
+		path := strings.Split(key[len(prefix):], "__")
+		for _, name := range path[:len(path)-1] {
+			inner, ok := m[name].(map[string]any)
+			if !ok {
+				inner = make(map[string]any)
+				m[name] = inner
+			}
+			m = inner
+		}
+		if _, ok := m[path[len(path)-1]].(map[string]any); !ok {
+			m[path[len(path)-1]] = val
+		}
+	}
+	return data
+}
+
+// normalize converts the maps and lists of decoded data to map[string]any
+// and []any, so sources in different formats merge alike.
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = normalize(e)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = normalize(e)
+		}
+		return m
+	case []any:
+		for i, e := range v {
+			v[i] = normalize(e)
+		}
+		return v
+	case []map[string]any:
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = normalize(e)
+		}
+		return l
+	}
+	return v
+}
+
+// listMerge merges the list src into the list dst.
+type listMerge func(dst, src []any) []any
+
+var listMerges = map[string]listMerge{
+	"replace": func(dst, src []any) []any { return src },
+	"append":  func(dst, src []any) []any { return append(dst[:len(dst):len(dst)], src...) },
+	"index":   mergeByIndex,
+}
+
+// mergeByIndex merges the items of src over those of dst at the same index.
+func mergeByIndex(dst, src []any) []any {
+	l := append([]any(nil), dst...)
+	for i, v := range src {
+		if i < len(l) {
+			l[i] = mergeValues(l[i], v, mergeByIndex)
+		} else {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+// mergeValues merges src over dst: maps are merged key by key, lists with
+// lists, and anything else is replaced by src.
+func mergeValues(dst, src any, lists listMerge) any {
+	switch s := src.(type) {
+	case map[string]any:
+		d, ok := dst.(map[string]any)
+		if !ok {
+			return src
+		}
+		m := make(map[string]any, len(d)+len(s))
+		for k, v := range d {
+			m[k] = v
+		}
+		for k, v := range s {
+			m[k] = mergeValues(m[k], v, lists)
+		}
+		return m
+	case []any:
+		if d, ok := dst.([]any); ok {
+			return lists(d, s)
+		}
+	}
+	return src
+}
+
+// setValue sets the value at the dotted name path in data, creating maps as
+// needed. Like lookups, numeric segments index into lists; the index just past
+// the end appends.
+func setValue(data any, path []string, val any) (any, error) {
+	if len(path) == 0 {
+		return val, nil
+	}
+	name := path[0]
+	switch d := data.(type) {
+	case nil:
+		inner, err := setValue(nil, path[1:], val)
+		return map[string]any{name: inner}, err
+	case map[string]any:
+		inner, err := setValue(d[name], path[1:], val)
+		d[name] = inner
+		return d, err
+	case []any:
+		i, err := strconv.Atoi(name)
+		if err != nil || i < 0 || i > len(d) {
+			return d, fmt.Errorf("%q is not an index of a list of %d", name, len(d))
+		}
+		if i == len(d) {
+			d = append(d, nil)
+		}
+		d[i], err = setValue(d[i], path[1:], val)
+		return d, err
+	}
+	return data, fmt.Errorf("cannot set %q in a %T", name, data)
+}
+
+// parseValue decodes a --set value as JSON if it is valid JSON, and returns
+// it as a string otherwise.
+func parseValue(s string) any {
+	if v, err := decodeJSON([]byte(s)); err == nil && json.Valid([]byte(s)) {
+		return normalize(v)
+	}
+	return s
+}
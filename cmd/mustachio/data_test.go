@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenderDataSources(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"t.mustache": "{{name}} {{db.host}}:{{db.port}} {{#tags}}{{.}},{{/tags}} {{debug}} {{region}} {{secret}}",
+		"base.json":  `{"name": "svc", "db": {"host": "localhost", "port": 5432}, "tags": ["a"], "debug": false}`,
+		"prod.yaml":  "db:\n  host: db.prod\ntags: [b, c]\n",
+		"extra.toml": "region = \"eu\"\n[db]\nport = 6432\n",
+		".env":       "# comment\nexport secret='s3 #x'\nregion=us # not eu\n",
+	})
+	args := []string{"render", "-t", "t.mustache", "-d", "base.json", "-d", "prod.yaml", "-d", "extra.toml"}
+	code, stdout, stderr := runCmd(t, dir, "", args...)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if want := "svc db.prod:6432 b,c, false eu "; stdout != want {
+		t.Errorf("got %q want %q", stdout, want)
+	}
+
+	args = append(args, "-d", ".env", "--merge-lists=append", "--set", "db.port=1", "--set", "debug=true", "--set", "tags.3=d", "--set", "name=x=y")
+	code, stdout, stderr = runCmd(t, dir, "", args...)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if want := "x=y db.prod:1 a,b,c,d, true us s3 #x"; stdout != want {
+		t.Errorf("got %q want %q", stdout, want)
+	}
+}
+
+func TestRenderEnvSource(t *testing.T) {
+	t.Setenv("MUSTACHIO_TEST_DB__HOST", "h")
+	t.Setenv("MUSTACHIO_TEST_NAME", "n")
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"t.mustache": "{{NAME}}@{{DB.HOST}}"})
+	code, stdout, stderr := runCmd(t, dir, "", "render", "-t", "t.mustache", "-d", "env:MUSTACHIO_TEST_")
+	if code != 0 || stdout != "n@h" {
+		t.Fatalf("exit %d, got %q: %s", code, stdout, stderr)
+	}
+	code, stdout, stderr = runCmd(t, dir, "a: [1, 2]", "render", "-t", "t.mustache", "-d", "yaml:-", "--set", "NAME=y")
+	if code != 0 || stdout != "y@" {
+		t.Fatalf("exit %d, got %q: %s", code, stdout, stderr)
+	}
+}
+
+func TestRenderDataErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"t.mustache": "",
+		"d.json":     `{"list": [1], "s": "x"}`,
+		"d.txt":      "",
+		"bad.env":    "novalue\n",
+		"bad.yaml":   "a: [\n",
+	})
+	tests := []struct {
+		args []string
+		code int
+		want string
+	}{
+		{[]string{"-d", "d.txt"}, 2, "unknown data format"},
+		{[]string{"-d", "d.json", "--merge-lists=zip"}, 2, `unknown list merge strategy "zip"`},
+		{[]string{"--set", "novalue"}, 2, "want name=value"},
+		{[]string{"-d", "-", "-d", "json:-"}, 2, "standard input"},
+		{[]string{"-d", "bad.env"}, 1, "bad.env: 1: want KEY=value"},
+		{[]string{"-d", "bad.yaml"}, 1, "bad.yaml: yaml: line"},
+		{[]string{"-d", "d.json", "--set", "list.2=x"}, 1, `--set list.2: "2" is not an index of a list of 1`},
+		{[]string{"-d", "d.json", "--set", "s.x=1"}, 1, `--set s.x: cannot set "x" in a string`},
+	}
+	for _, tt := range tests {
+		code, _, stderr := runCmd(t, dir, "", append([]string{"render", "-t", "t.mustache"}, tt.args...)...)
+		if code != tt.code || !strings.Contains(stderr, tt.want) {
+			t.Errorf("%v: exit %d, stderr %q; want exit %d with %q", tt.args, code, stderr, tt.code, tt.want)
+		}
+	}
+}
+
+func TestMergeValues(t *testing.T) {
+	dst := map[string]any{"a": map[string]any{"x": 1, "l": []any{map[string]any{"k": 1, "j": 2}, 2}}, "b": 1}
+	src := map[string]any{"a": map[string]any{"y": 2, "l": []any{map[string]any{"k": 3}}}, "b": map[string]any{}}
+	tests := map[string]any{
+		"replace": map[string]any{"a": map[string]any{"x": 1, "y": 2, "l": []any{map[string]any{"k": 3}}}, "b": map[string]any{}},
+		"append":  map[string]any{"a": map[string]any{"x": 1, "y": 2, "l": []any{map[string]any{"k": 1, "j": 2}, 2, map[string]any{"k": 3}}}, "b": map[string]any{}},
+		"index":   map[string]any{"a": map[string]any{"x": 1, "y": 2, "l": []any{map[string]any{"k": 3, "j": 2}, 2}}, "b": map[string]any{}},
+	}
+	for name, want := range tests {
+		if got := mergeValues(dst, src, listMerges[name]); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v want %v", name, got, want)
+		}
+	}
+	if got := dst["a"].(map[string]any)["l"].([]any)[0].(map[string]any)["k"]; got != 1 {
+		t.Errorf("dst was modified: %v", dst)
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	for s, want := range map[string]string{
+		"1.50":      "json.Number 1.50",
+		"true":      "bool true",
+		"null":      "<nil> <nil>",
+		`"quoted"`:  "string quoted",
+		"plain":     "string plain",
+		"01":        "string 01",
+		"[1,\"a\"]": "[]interface {} [1 a]",
+		"{oops":     "string {oops",
+	} {
+		v := parseValue(s)
+		if got := fmt.Sprintf("%T %v", v, v); got != want {
+			t.Errorf("%s: got %s want %s", s, got, want)
+		}
+	}
+}
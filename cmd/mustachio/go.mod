@@ -0,0 +1,12 @@
+module github.com/weese/mustachio/cmd/mustachio
+
+go 1.22
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/weese/mustachio v0.0.0-00010101000000-000000000000
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+// The command is developed together with the library.
+replace github.com/weese/mustachio => ../..
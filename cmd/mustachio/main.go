@@ -0,0 +1,81 @@
+// Command mustachio renders Mustache templates from the command line.
+//
+// Usage:
+//
+//	mustachio render -t template.mustache [-d data.json ...] [--set name=value ...] [-p partials/] [-o out.txt] [--strict] [--escape=html]
+//
+// Data is read from JSON, YAML, TOML and .env files, standard input and
+// environment variables; several -d sources are deep-merged in order, and
+// --set overrides single values. Partials are loaded from a directory,
+// {{> emails/footer}} being partials/emails/footer.mustache.
+//
+//	mustachio scaffold <templateDir> <outDir> [-d answers.json ...] [--dry-run] [--force]
+//
+// renders a whole directory tree, including the names of its files and
+// directories, such as {{service}}/cmd/{{service}}/main.go. A name that
+// renders empty, such as {{#docker}}Dockerfile{{/docker}}, leaves the file or
+// directory out. Binary files are copied as they are.
+//
+// Errors are reported with the file, line and column they occur at, and
+// make mustachio exit with status 1.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: mustachio <command> [flags]
+
+commands:
+  render    render a template with data
+  scaffold  render a directory tree, file names included
+
+Run "mustachio <command> -h" for the flags of a command.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command line args and returns the exit status: 0 on success,
+// 1 when rendering fails and 2 for usage errors.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	var err error
+	switch args[0] {
+	case "render":
+		err = render(args[1:], stdin, stdout, stderr)
+	case "scaffold":
+		err = scaffold(args[1:], stdin, stdout, stderr)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "mustachio: unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+	var uerr usageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &uerr):
+		if uerr.msg != "" {
+			fmt.Fprintf(stderr, "mustachio %s: %s\n", args[0], uerr.msg)
+		}
+		return 2
+	}
+	reportError(stderr, err)
+	return 1
+}
+
+// usageError reports bad command line arguments. The flag package has
+// already printed the details if msg is empty.
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates the files in dir, keyed by slash-separated path.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func runCmd(t *testing.T, dir, stdin string, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	var out, errOut bytes.Buffer
+	code = run(args, strings.NewReader(stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"page.mustache":                   "{{>header}}{{#items}}{{.}} {{/items}}{{>emails/footer}}",
+		"data.json":                       `{"title": "A & B", "items": [1, 2.50], "year": 2024}`,
+		"partials/header.mustache":        "<h1>{{title}}</h1>\n",
+		"partials/emails/footer.mustache": "(c) {{year}}\n",
+	})
+	code, stdout, stderr := runCmd(t, dir, "", "render", "-t", "page.mustache", "-d", "data.json", "-p", "partials")
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if want := "<h1>A &amp; B</h1>\n1 2.50 (c) 2024\n"; stdout != want {
+		t.Errorf("got %q want %q", stdout, want)
+	}
+
+	code, _, stderr = runCmd(t, dir, "", "render", "-t", "page.mustache", "-d", "data.json", "-p", "partials", "-o", "out.txt", "--escape=none")
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<h1>A & B</h1>\n1 2.50 (c) 2024\n"; string(b) != want {
+		t.Errorf("got %q want %q", b, want)
+	}
+}
+
+func TestRenderStdin(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"t.mustache": "{{name}}"})
+	code, stdout, stderr := runCmd(t, dir, `{"name": "\"x\""}`, "render", "-t", "t.mustache", "-d", "-", "--escape", "json")
+	if code != 0 || stdout != `\"x\"` {
+		t.Fatalf("exit %d, got %q: %s", code, stdout, stderr)
+	}
+	code, stdout, stderr = runCmd(t, dir, "[{{x}}]", "render", "-t", "-")
+	if code != 0 || stdout != "[]" {
+		t.Fatalf("exit %d, got %q: %s", code, stdout, stderr)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"bad.mustache": "line one\n{{#a}}\n",
+		"ok.mustache":  "{{a.b}}",
+		"data.json":    "{\n  \"a\": 1,\n}",
+	})
+	tests := []struct {
+		args []string
+		code int
+		want string
+	}{
+		{[]string{"render", "-t", "bad.mustache"}, 1, "mustachio: bad.mustache:2:1: "},
+		{[]string{"render", "-t", "ok.mustache", "-d", "data.json"}, 1, "mustachio: data.json:3:1: "},
+		{[]string{"render", "-t", "ok.mustache", "--strict"}, 1, "mustachio: ok.mustache:1:1: "},
+		{[]string{"render", "-t", "missing.mustache"}, 1, "missing.mustache"},
+		{[]string{"render", "-t", "ok.mustache", "--escape=xml"}, 2, `unknown escape mode "xml"`},
+		{[]string{"render"}, 2, "-t is required"},
+		{[]string{"render", "-t", "-", "-d", "-"}, 2, "standard input"},
+		{[]string{"render", "-x"}, 2, "flag provided but not defined"},
+		{[]string{"frobnicate"}, 2, `unknown command "frobnicate"`},
+		{nil, 2, "usage: mustachio"},
+	}
+	for _, tt := range tests {
+		code, stdout, stderr := runCmd(t, dir, "", tt.args...)
+		if code != tt.code || !strings.Contains(stderr, tt.want) {
+			t.Errorf("%v: exit %d, stderr %q; want exit %d with %q", tt.args, code, stderr, tt.code, tt.want)
+		}
+		if stdout != "" {
+			t.Errorf("%v: unexpected output %q", tt.args, stdout)
+		}
+	}
+	if _, _, stderr := runCmd(t, dir, "", "render", "-t", "bad.mustache"); !strings.Contains(stderr, "2 | {{#a}}\n  | ^") {
+		t.Errorf("no snippet in %q", stderr)
+	}
+}
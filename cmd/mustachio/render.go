@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/weese/mustachio"
+)
+
+// escapeModes are the values of the --escape flag.
+var escapeModes = map[string]mustachio.EscapeMode{
+	"html":            mustachio.EscapeHTML,
+	"none":            mustachio.EscapeNone,
+	"json":            mustachio.EscapeJSON,
+	"js":              mustachio.EscapeJS,
+	"url":             mustachio.EscapeURL,
+	"csv":             mustachio.EscapeCSV,
+	"shell":           mustachio.EscapeShell,
+	"html-contextual": mustachio.EscapeHTMLContextual,
+}
+
+func render(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("mustachio render", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	tplPath := fs.String("t", "", "template `file`, or - for standard input")
+	var data dataFlags
+	data.register(fs)
+	partialsDir := fs.String("p", "", "`directory` to load partials from")
+	ext := fs.String("ext", ".mustache", "file extension of partials")
+	outPath := fs.String("o", "", "output `file` (default standard output)")
+	strict := fs.Bool("strict", false, "fail on missing variables, sections and partials")
+	escape := fs.String("escape", "html", "escaping of {{name}} tags: "+strings.Join(sortedModes(), ", "))
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return usageError{}
+	}
+	switch {
+	case fs.NArg() > 0:
+		return usageError{fmt.Sprintf("unexpected argument %q", fs.Arg(0))}
+	case *tplPath == "":
+		return usageError{"-t is required"}
+	case data.stdinSources() > 1, *tplPath == "-" && data.stdinSources() > 0:
+		return usageError{"only one of -t and -d can read standard input"}
+	}
+	mode, ok := escapeModes[*escape]
+	if !ok {
+		return usageError{fmt.Sprintf("unknown escape mode %q", *escape)}
+	}
+
+	src, err := readInput(*tplPath, stdin)
+	if err != nil {
+		return err
+	}
+	values, err := data.load(stdin)
+	if err != nil {
+		return err
+	}
+	opts := []mustachio.Option{mustachio.WithName(*tplPath), mustachio.WithEscapeMode(mode)}
+	if *partialsDir != "" {
+		opts = append(opts, mustachio.WithPartialsContext(mustachio.NewFSPartials(os.DirFS(*partialsDir), *ext)))
+	}
+	if *strict {
+		opts = append(opts, mustachio.WithStrict(), mustachio.WithStrictPartials())
+	}
+	tpl, err := mustachio.Compile(string(src), opts...)
+	if err != nil {
+		return err
+	}
+	// Render into memory first, so a failed render leaves no partial output.
+	var out bytes.Buffer
+	if err := tpl.Execute(&out, values); err != nil {
+		return err
+	}
+	if *outPath == "" {
+		_, err = stdout.Write(out.Bytes())
+		return err
+	}
+	return os.WriteFile(*outPath, out.Bytes(), 0o644)
+}
+
+// readInput reads the file at path, or stdin if path is "-".
+func readInput(path string, stdin io.Reader) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// reportError prints err, with the source line for syntax errors.
+func reportError(w io.Writer, err error) {
+	fmt.Fprintf(w, "mustachio: %v\n", err)
+	var perr *mustachio.ParseError
+	if errors.As(err, &perr) && perr.Snippet != "" {
+		fmt.Fprintln(w, perr.Snippet)
+	}
+}
+
+func sortedModes() []string {
+	modes := make([]string, 0, len(escapeModes))
+	for name := range escapeModes {
+		modes = append(modes, name)
+	}
+	sort.Strings(modes)
+	return modes
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/weese/mustachio"
+)
+
+// entry is a file or directory a scaffold writes.
+type entry struct {
+	path    string // slash-separated, relative to the output directory
+	mode    fs.FileMode
+	content []byte // nil for directories
+	binary  bool   // copied without rendering
+}
+
+func scaffold(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("mustachio scaffold", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: mustachio scaffold [flags] <templateDir> <outDir>")
+		fs.PrintDefaults()
+	}
+	var data dataFlags
+	data.register(fs)
+	dryRun := fs.Bool("dry-run", false, "list what would be written without writing it")
+	force := fs.Bool("force", false, "overwrite existing files")
+	strict := fs.Bool("strict", false, "fail on missing variables and sections")
+	escape := fs.String("escape", "none", "escaping of {{name}} tags in file contents")
+	dirs, err := parseInterleaved(fs, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return usageError{}
+	}
+	switch {
+	case len(dirs) != 2:
+		return usageError{"want a template directory and an output directory"}
+	case data.stdinSources() > 1:
+		return usageError{"only one -d can read standard input"}
+	}
+	mode, ok := escapeModes[*escape]
+	if !ok {
+		return usageError{fmt.Sprintf("unknown escape mode %q", *escape)}
+	}
+	values, err := data.load(stdin)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(dirs[0]); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dirs[0])
+	}
+	entries, err := plan(os.DirFS(dirs[0]), filepath.ToSlash(dirs[0]), values, mode, *strict)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		for _, e := range entries {
+			note := ""
+			if e.binary {
+				note = " (copied)"
+			}
+			fmt.Fprintf(stdout, "%v %s%s\n", e.mode, filepath.Join(dirs[1], filepath.FromSlash(e.path)), note)
+		}
+		return nil
+	}
+	if !*force {
+		for _, e := range entries {
+			name := filepath.Join(dirs[1], filepath.FromSlash(e.path))
+			if info, err := os.Stat(name); err == nil && !(info.IsDir() && e.mode.IsDir()) {
+				return fmt.Errorf("%s already exists; use --force to overwrite", name)
+			}
+		}
+	}
+	for _, e := range entries {
+		if err := write(dirs[1], e); err != nil {
+			return err
+		}
+	}
+	// Directories get their permissions last, in case they are read-only.
+	for i := len(entries) - 1; i >= 0; i-- {
+		if e := entries[i]; e.mode.IsDir() {
+			if err := os.Chmod(filepath.Join(dirs[1], filepath.FromSlash(e.path)), e.mode.Perm()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseInterleaved parses args with flags before, between and after the
+// positional arguments, and returns the positional ones.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return pos, nil
+		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// plan renders the tree in fsys into the entries to write, sorted by path.
+// The path of each file and directory is rendered as a template, so a
+// section can span several path segments: as names cannot contain a slash,
+// {{#api}}api{{/api}}/handler.go is stored as the directories "{{#api}}api{{"
+// and "api}}" holding handler.go. Directories whose path does not parse yet
+// are not written on their own. A path with an empty segment, such as
+// {{#docker}}Dockerfile{{/docker}} when docker is false, is left out, a
+// directory with everything in it. Errors name files by root and path.
+func plan(fsys fs.FS, root string, data any, mode mustachio.EscapeMode, strict bool) ([]entry, error) {
+	pathOpts := []mustachio.Option{mustachio.WithEscapeMode(mustachio.EscapeNone)}
+	contentOpts := []mustachio.Option{mustachio.WithEscapeMode(mode)}
+	if strict {
+		pathOpts = append(pathOpts, mustachio.WithStrict())
+		contentOpts = append(contentOpts, mustachio.WithStrict())
+	}
+	var entries []entry
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == "." {
+			return err
+		}
+		name := path.Join(root, p)
+		dst, err := renderString(name+" (path)", p, data, pathOpts)
+		var perr *mustachio.ParseError
+		if d.IsDir() && errors.As(err, &perr) {
+			return nil // a section continues in the directories below
+		} else if err != nil {
+			return err
+		}
+		for _, seg := range strings.Split(dst, "/") {
+			if seg == "" {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+		}
+		if !filepath.IsLocal(filepath.FromSlash(dst)) {
+			return fmt.Errorf("%s: path renders to %q, outside the output directory", name, dst)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		e := entry{path: dst, mode: info.Mode().Perm()}
+		switch {
+		case d.IsDir():
+			e.mode |= fs.ModeDir
+		case info.Mode().IsRegular():
+			b, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return err
+			}
+			e.content, e.binary = b, isBinary(b)
+			if !e.binary {
+				s, err := renderString(name, string(b), data, contentOpts)
+				if err != nil {
+					return err
+				}
+				e.content = []byte(s)
+			}
+		default:
+			return fmt.Errorf("%s: unsupported file type %v", name, info.Mode().Type())
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	// Parents sort before their children, which WalkDir does not ensure when
+	// sections span directories.
+	sort.Slice(entries, func(i, j int) bool { return entries[i].path < entries[j].path })
+	return entries, err
+}
+
+func renderString(name, src string, data any, opts []mustachio.Option) (string, error) {
+	tpl, err := mustachio.Compile(src, append(opts[:len(opts):len(opts)], mustachio.WithName(name))...)
+	if err != nil {
+		return "", err
+	}
+	return tpl.Render(data)
+}
+
+// isBinary reports whether b looks like a binary file rather than text: it
+// has a NUL byte in the first 8000 bytes, as git checks, or is not UTF-8.
+func isBinary(b []byte) bool {
+	return bytes.IndexByte(b[:min(len(b), 8000)], 0) >= 0 || !utf8.Valid(b)
+}
+
+// write creates e below dir. Files get their permissions, directories are
+// left writable.
+func write(dir string, e entry) error {
+	name := filepath.Join(dir, filepath.FromSlash(e.path))
+	if e.mode.IsDir() {
+		return os.MkdirAll(name, 0o755)
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(name, e.content, e.mode); err != nil {
+		return err
+	}
+	// WriteFile applies the umask and leaves existing files' modes alone.
+	return os.Chmod(name, e.mode)
+}
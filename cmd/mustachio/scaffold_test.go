@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScaffold(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tpl/{{service}}/cmd/{{service}}/main.go":          "package main // {{service}} <{{owner}}>\n",
+		"tpl/{{service}}/README.md":                        "# {{service}}\n{{#docker}}docker{{/docker}}",
+		"tpl/{{service}}/{{#docker}}Dockerfile{{/docker}}": "FROM {{image}}\n",
+		"tpl/{{service}}/{{#api}}api{{/api}}/api.go":       "package api\n",
+		"tpl/{{service}}/logo.png":                         "\x89PNG\x00{{service}}",
+		"tpl/{{service}}/run.sh":                           "#!/bin/sh\necho {{service}}\n",
+		"answers.json":                                     `{"service": "billing", "owner": "a&b", "docker": false, "api": true}`,
+	})
+	if err := os.Chmod(filepath.Join(dir, "tpl/{{service}}/run.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runCmd(t, dir, "", "scaffold", "tpl", "out", "-d", "answers.json", "--dry-run")
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	want := `drwxr-xr-x out/billing
+-rw-r--r-- out/billing/README.md
+drwxr-xr-x out/billing/api
+-rw-r--r-- out/billing/api/api.go
+drwxr-xr-x out/billing/cmd
+drwxr-xr-x out/billing/cmd/billing
+-rw-r--r-- out/billing/cmd/billing/main.go
+-rw-r--r-- out/billing/logo.png (copied)
+-rwxr-xr-x out/billing/run.sh
+`
+	if stdout != want {
+		t.Errorf("got\n%s\nwant\n%s", stdout, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out")); !os.IsNotExist(err) {
+		t.Fatalf("dry run wrote output: %v", err)
+	}
+
+	code, stdout, stderr = runCmd(t, dir, "", "scaffold", "-d", "answers.json", "--set", "docker=true", "--set", "image=alpine", "tpl", "out")
+	if code != 0 || stdout != "" {
+		t.Fatalf("exit %d, output %q: %s", code, stdout, stderr)
+	}
+	for name, want := range map[string]string{
+		"billing/cmd/billing/main.go": "package main // billing <a&b>\n",
+		"billing/README.md":           "# billing\ndocker",
+		"billing/Dockerfile":          "FROM alpine\n",
+		"billing/logo.png":            "\x89PNG\x00{{service}}",
+		"billing/api/api.go":          "package api\n",
+	} {
+		b, err := os.ReadFile(filepath.Join(dir, "out", name))
+		if err != nil {
+			t.Error(err)
+		} else if string(b) != want {
+			t.Errorf("%s: got %q want %q", name, b, want)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dir, "out/billing/run.sh")); err != nil || info.Mode().Perm() != 0o755 {
+		t.Errorf("run.sh: %v, %v", info.Mode(), err)
+	}
+
+	code, _, stderr = runCmd(t, dir, "", "scaffold", "tpl", "out", "-d", "answers.json")
+	if code != 1 || !strings.Contains(stderr, "already exists; use --force") {
+		t.Errorf("exit %d: %s", code, stderr)
+	}
+	code, _, stderr = runCmd(t, dir, "", "scaffold", "tpl", "out", "-d", "answers.json", "--set", "owner=c", "--force")
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "out/billing/cmd/billing/main.go")); string(b) != "package main // billing <c>\n" {
+		t.Errorf("not overwritten: %q", b)
+	}
+}
+
+func TestScaffoldErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"bad/{{x}}.txt":       "{{#open}}",
+		"escape/{{up}}/f.txt": "",
+		"strict/{{name}}.txt": "",
+	})
+	tests := []struct {
+		args []string
+		code int
+		want string
+	}{
+		{[]string{"bad", "out"}, 1, "bad/{{x}}.txt:1:1: "},
+		{[]string{"escape", "out", "--set", "up=.."}, 1, `escape/{{up}}: path renders to "..", outside the output directory`},
+		{[]string{"strict", "out", "--strict"}, 1, "strict/{{name}}.txt (path):1:1: missing key"},
+		{[]string{"strict"}, 2, "want a template directory and an output directory"},
+		{[]string{"missing", "out"}, 1, "stat missing: "},
+	}
+	for _, tt := range tests {
+		code, _, stderr := runCmd(t, dir, "", append([]string{"scaffold"}, tt.args...)...)
+		if code != tt.code || !strings.Contains(stderr, tt.want) {
+			t.Errorf("%v: exit %d, stderr %q; want exit %d with %q", tt.args, code, stderr, tt.code, tt.want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out")); !os.IsNotExist(err) {
+		t.Errorf("failed scaffold wrote output: %v", err)
+	}
+}
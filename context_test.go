@@ -0,0 +1,74 @@
+package mustachio
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type ctxKey struct{}
+
+func TestExecuteContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := 0
+	data := map[string]any{
+		"items": make([]any, 1000),
+		"tick": func() string {
+			if n++; n == 3 {
+				cancel()
+			}
+			return "."
+		},
+	}
+	tpl, err := Compile("{{#items}}{{tick}}{{/items}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	err = tpl.ExecuteContext(ctx, &b, data)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	// the output of the lambda that cancels is not rendered anymore
+	if b.String() != ".." {
+		t.Fatalf("got %q", b.String())
+	}
+	if _, err := tpl.RenderContext(ctx, data); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestContextPassedToLambdasAndLoaders(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ctxKey{}, "de")
+	data := map[string]any{
+		"locale": func(ctx context.Context) string { return ctx.Value(ctxKey{}).(string) },
+		"upper": func(ctx context.Context, s string) string {
+			return strings.ToUpper(s) + ctx.Value(ctxKey{}).(string)
+		},
+		"wrap": func(ctx context.Context, s string, render func(string) string) string {
+			return "<" + render(s) + ">"
+		},
+	}
+	loader := loaderFunc(func(ctx context.Context, name string) (string, error) {
+		return name + "-" + ctx.Value(ctxKey{}).(string), nil
+	})
+	tpl, err := Compile("{{locale}} {{#upper}}x{{/upper}} {{#wrap}}{{locale}}{{/wrap}} {{>p}}", WithPartialsContext(loader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.RenderContext(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "de Xde <de> p-de" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+type loaderFunc func(ctx context.Context, name string) (string, error)
+
+func (f loaderFunc) LoadPartial(ctx context.Context, name string) (string, error) {
+	return f(ctx, name)
+}
@@ -0,0 +1,45 @@
+package mustachio
+
+import "testing"
+
+func TestDynamicNames(t *testing.T) {
+	cases := []struct {
+		name     string
+		data     any
+		template string
+		partials MapPartials
+		expected string
+	}{
+		{"basic", map[string]any{"dynamic": "content"}, `"{{>*dynamic}}"`, MapPartials{"content": "Hello, world!"}, `"Hello, world!"`},
+		{"name resolution", map[string]any{"dynamic": "content"}, `"{{>*dynamic}}"`,
+			MapPartials{"content": "Hello, world!", "dynamic": "Wrong"}, `"Hello, world!"`},
+		{"context", map[string]any{"text": "content", "example": "partial"}, `"{{>*example}}"`,
+			MapPartials{"partial": "*{{text}}*"}, `"*content*"`},
+		{"dotted names", map[string]any{"foo": map[string]any{"bar": map[string]any{"baz": "partial"}}}, `"{{>*foo.bar.baz}}"`,
+			MapPartials{"partial": "Hello, world!"}, `"Hello, world!"`},
+		{"dotted names failed lookup", map[string]any{"foo": map[string]any{"bar": map[string]any{"baz": "partial"}}}, `"{{>*foo.bar.quux}}"`,
+			MapPartials{"partial": "Hello, world!"}, `""`},
+		{"context stacking under repetition", map[string]any{"value": "test", "section1": []any{map[string]any{"dynamic": "content"}, map[string]any{"dynamic": "content"}}},
+			"{{#section1}}{{>*dynamic}}{{/section1}}", MapPartials{"content": "{{value}}"}, "testtest"},
+		{"recursion", map[string]any{"template": "node", "content": "X", "nodes": []any{map[string]any{"content": "Y", "nodes": []any{}}}},
+			"{{>*template}}", MapPartials{"node": "{{content}}<{{#nodes}}{{>*template}}{{/nodes}}>"}, "X<Y<>>"},
+		{"surrounding whitespace", map[string]any{"partial": "foobar"}, "| {{>*partial}} |", MapPartials{"foobar": "\t|\t"}, "| \t|\t |"},
+		{"standalone indentation", map[string]any{"dynamic": "partial", "content": "<\n->"}, "\\\n {{>*dynamic}}\n/\n",
+			MapPartials{"partial": "|\n{{{content}}}\n|\n"}, "\\\n |\n <\n->\n |\n/\n"},
+		{"padding whitespace", map[string]any{"dynamic": "partial", "boolean": true}, "|{{> * dynamic }}|",
+			MapPartials{"partial": "[]"}, "|[]|"},
+		{"dynamic parent", map[string]any{"layout": "base"}, "{{<*layout}}{{$body}}hi{{/body}}{{/layout}}",
+			MapPartials{"base": "<{{$body}}{{/body}}>"}, "<hi>"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := Render(tc.template, tc.data, tc.partials)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != tc.expected {
+				t.Fatalf("got %q want %q", out, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package mustachio
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Position identifies a location in a template source.
+type Position struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column in bytes, starting at 1
+}
+
+func (p Position) String() string { return fmt.Sprintf("%d:%d", p.Line, p.Column) }
+
+// positionAt converts a byte offset in src into a Position.
+func positionAt(src string, offset int) Position {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	line := 1 + strings.Count(src[:offset], "\n")
+	lineStart := strings.LastIndexByte(src[:offset], '\n') + 1
+	return Position{Offset: offset, Line: line, Column: offset - lineStart + 1}
+}
+
+// ParseError describes a syntax error in a template. Use errors.As to
+// retrieve it from the error returned by Compile, Render or Execute.
+type ParseError struct {
+	Name string // template or partial name, empty if unknown
+	Position
+	Tag     string    // source text of the offending tag
+	Open    *Position // opening tag of the section involved, if any
+	Msg     string
+	Snippet string // source line of the error with a caret under the column
+}
+
+func (e *ParseError) Error() string {
+	var b strings.Builder
+	if e.Name != "" {
+		b.WriteString(e.Name)
+		b.WriteByte(':')
+	}
+	fmt.Fprintf(&b, "%s: %s", e.Position, e.Msg)
+	if e.Open != nil {
+		fmt.Fprintf(&b, " (opened at %s)", e.Open)
+	}
+	return b.String()
+}
+
+// newParseError builds a ParseError for the tag spanning src[start:end].
+func newParseError(src string, start, end int, msg string) *ParseError {
+	if end > len(src) {
+		end = len(src)
+	}
+	pos := positionAt(src, start)
+	return &ParseError{
+		Position: pos,
+		Tag:      src[start:end],
+		Msg:      msg,
+		Snippet:  snippet(src, pos),
+	}
+}
+
+// unindent moves the positions of an error found in src indented by n bytes
+// per line (see applyIndent) back to src.
+func (e *ParseError) unindent(src string, n int) {
+	fix := func(p Position) Position {
+		return positionAt(src, p.Offset-(p.Line-1)*n-min(p.Column-1, n))
+	}
+	e.Position = fix(e.Position)
+	if e.Open != nil {
+		open := fix(*e.Open)
+		e.Open = &open
+	}
+	e.Snippet = snippet(src, e.Position)
+}
+
+// snippet renders the source line containing pos followed by a caret line:
+//
+//	3 | Hello {{/name}}
+//	  |       ^
+func snippet(src string, pos Position) string {
+	lineStart := pos.Offset - (pos.Column - 1)
+	lineEnd := strings.IndexByte(src[lineStart:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(src)
+	} else {
+		lineEnd += lineStart
+	}
+	line := strings.TrimSuffix(src[lineStart:lineEnd], "\r")
+	num := fmt.Sprint(pos.Line)
+	var caret strings.Builder
+	for i := lineStart; i < pos.Offset; i++ {
+		// keep tabs so the caret lines up with the source
+		if src[i] == '\t' {
+			caret.WriteByte('\t')
+		} else {
+			caret.WriteByte(' ')
+		}
+	}
+	return fmt.Sprintf("%s | %s\n%s | %s^", num, line, strings.Repeat(" ", len(num)), caret.String())
+}
+
+// MissingKeyError is returned in strict mode (see WithStrict) when a name
+// cannot be resolved against the context stack.
+type MissingKeyError struct {
+	Template string // template or partial name, empty if unknown
+	Name     string // the name as written in the tag, e.g. "user.address.city"
+	Segment  string // the first segment of Name that could not be resolved
+	Position        // position of the tag
+	Depth    int    // number of contexts on the stack, or -1 if unknown
+}
+
+func (e *MissingKeyError) Error() string {
+	msg := fmt.Sprintf("%s: missing key %q", e.Position, e.Name)
+	if e.Segment != e.Name {
+		msg += fmt.Sprintf(" (%q not found)", e.Segment)
+	}
+	if e.Template != "" {
+		msg = e.Template + ":" + msg
+	}
+	return msg
+}
+
+// missingKey builds the MissingKeyError for a name that p failed to resolve.
+// The failing segment is found by resolving ever longer prefixes of the name.
+func missingKey(name string, pos Position, p ValueProvider, st *renderState) error {
+	segment := name
+	if name != "." {
+		segments := strings.Split(name, ".")
+		for i := range segments {
+			if _, ok := p.Lookup(strings.Join(segments[:i+1], ".")); !ok {
+				segment = segments[i]
+				break
+			}
+		}
+	}
+	depth := -1
+	if d, ok := p.(interface{ depth() int }); ok {
+		depth = d.depth()
+	}
+	return &MissingKeyError{Template: st.name, Name: name, Segment: segment, Position: pos, Depth: depth}
+}
+
+// MissingPartialError is returned when a partial or parent cannot be loaded
+// and WithStrictPartials is set.
+type MissingPartialError struct {
+	Template string // template or partial containing the tag
+	Name     string // name of the partial that could not be loaded
+	Position        // position of the tag
+}
+
+func (e *MissingPartialError) Error() string {
+	msg := fmt.Sprintf("%s: missing partial %q", e.Position, e.Name)
+	if e.Template != "" {
+		msg = e.Template + ":" + msg
+	}
+	return msg
+}
+
+// PartialError is returned when a PartialLoaderContext fails to load a
+// partial or parent for a reason other than ErrPartialNotFound.
+type PartialError struct {
+	Name     string   // name of the partial that could not be loaded
+	Chain    []string // named templates and partials that include it, outermost first
+	Position          // position of the tag
+	Err      error
+}
+
+func (e *PartialError) Error() string {
+	msg := fmt.Sprintf("%s: loading partial %q: %v", e.Position, e.Name, e.Err)
+	if len(e.Chain) > 0 {
+		msg = strings.Join(e.Chain, " > ") + ":" + msg
+	}
+	return msg
+}
+
+func (e *PartialError) Unwrap() error { return e.Err }
+
+// LambdaError is returned when a lambda returns an error or panics, or when
+// the template text returned by a lambda cannot be parsed.
+type LambdaError struct {
+	Template string // template or partial containing the tag
+	Name     string // name the lambda was looked up by
+	Position        // position of the tag
+	Err      error  // the error returned by the lambda, if any
+	Panic    any    // the value the lambda panicked with, if any
+	Stack    []byte // the stack trace of the panic
+}
+
+func (e *LambdaError) Error() string {
+	var msg string
+	if e.Panic != nil {
+		msg = fmt.Sprintf("%s: lambda %q panicked: %v", e.Position, e.Name, e.Panic)
+	} else {
+		msg = fmt.Sprintf("%s: lambda %q: %v", e.Position, e.Name, e.Err)
+	}
+	if e.Template != "" {
+		msg = e.Template + ":" + msg
+	}
+	return msg
+}
+
+func (e *LambdaError) Unwrap() error { return e.Err }
@@ -0,0 +1,83 @@
+package mustachio
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseErrorSectionMismatch(t *testing.T) {
+	src := "line one\n{{#a}}\n\t  {{/b}} tail\n"
+	_, err := Compile(src, WithName("page"))
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected *ParseError, got %T %v", err, err)
+	}
+	if perr.Name != "page" || perr.Line != 3 || perr.Column != 4 || perr.Offset != 19 || perr.Tag != "{{/b}}" {
+		t.Fatalf("unexpected error fields: %+v", perr)
+	}
+	if perr.Open == nil || perr.Open.Line != 2 || perr.Open.Column != 1 {
+		t.Fatalf("unexpected open position: %+v", perr.Open)
+	}
+	if err.Error() != "page:3:4: section mismatch: a vs b (opened at 2:1)" {
+		t.Fatalf("got %q", err.Error())
+	}
+	if perr.Snippet != "3 | \t  {{/b}} tail\n  | \t  ^" {
+		t.Fatalf("got snippet %q", perr.Snippet)
+	}
+}
+
+func TestParseErrorLexer(t *testing.T) {
+	cases := []struct {
+		src, msg, tag string
+		line, col     int
+	}{
+		{"ok\nHello {{name", "unclosed tag", "{{name", 2, 7},
+		{"{{{name}}", "unclosed triple mustache", "{{{name}}", 1, 1},
+		{"a {{=<% =}}", "invalid set delimiters", "{{=<% =}}", 1, 3},
+		{"x\n{{#list}}\n", "unclosed section list", "{{#list}}", 2, 1},
+		{"{{/list}}", "unmatched section end for list", "{{/list}}", 1, 1},
+	}
+	for _, c := range cases {
+		_, err := Render(c.src, nil, nil)
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Fatalf("%q: expected *ParseError, got %v", c.src, err)
+		}
+		if perr.Msg != c.msg || perr.Tag != c.tag || perr.Line != c.line || perr.Column != c.col {
+			t.Fatalf("%q: unexpected error fields: %+v", c.src, perr)
+		}
+	}
+}
+
+func TestParseErrorInPartialIsNamed(t *testing.T) {
+	_, err := Render("{{> broken}}", nil, MapPartials{"broken": "{{#x}}"})
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Name != "broken" {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestParseErrorInIndentedPartial(t *testing.T) {
+	partials := MapPartials{"p": "x\n{{#a}}\n {{/nope}}\n", "q": "x\n{{/nope}}"}
+	for _, tpl := range []string{"{{>p}}", "    {{>p}}"} {
+		_, err := Render(tpl, nil, partials)
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Fatalf("%q: got %v", tpl, err)
+		}
+		if got := err.Error(); got != "p:3:2: section mismatch: a vs nope (opened at 2:1)" {
+			t.Errorf("%q: got %q", tpl, got)
+		}
+		if perr.Offset != 10 || perr.Open.Offset != 2 {
+			t.Errorf("%q: offsets %d, %d", tpl, perr.Offset, perr.Open.Offset)
+		}
+		if want := "3 |  {{/nope}}\n  |  ^"; perr.Snippet != want {
+			t.Errorf("%q: snippet %q want %q", tpl, perr.Snippet, want)
+		}
+	}
+	_, err := Render("a\n\t{{>q}}", nil, partials)
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Position != (Position{Offset: 2, Line: 2, Column: 1}) {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package mustachio
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// Escaper escapes the value of a {{name}} tag before it is written.
+type Escaper func(string) string
+
+// EscapeMode selects a built-in Escaper, see WithEscapeMode.
+type EscapeMode int
+
+const (
+	// EscapeHTML escapes &, <, >, " and ' as HTML entities (the default).
+	EscapeHTML EscapeMode = iota
+	// EscapeNone writes values unchanged.
+	EscapeNone
+	// EscapeJSON escapes values for use inside a JSON string literal.
+	EscapeJSON
+	// EscapeJS escapes values for use inside a JavaScript string literal
+	// delimited by ', " or `, also within an HTML <script> element.
+	EscapeJS
+	// EscapeURL escapes values as a URL query component.
+	EscapeURL
+	// EscapeCSV quotes values as a CSV field if they need it (RFC 4180).
+	EscapeCSV
+	// EscapeShell quotes values as a single POSIX shell word.
+	EscapeShell
+	// EscapeHTMLContextual escapes values for where they appear in an HTML
+	// document: element content, attribute values, URLs, JavaScript or CSS.
+	// Dangerous URL schemes are filtered. Use SafeHTML, SafeURL, SafeJS and
+	// SafeCSS values to bypass it deliberately.
+	EscapeHTMLContextual
+)
+
+// Escaper returns the escaping function of the mode.
+func (m EscapeMode) Escaper() Escaper {
+	switch m {
+	case EscapeNone:
+		return func(s string) string { return s }
+	case EscapeJSON:
+		return escapeJSON
+	case EscapeJS:
+		return escapeJS
+	case EscapeURL:
+		return url.QueryEscape
+	case EscapeCSV:
+		return escapeCSV
+	case EscapeShell:
+		return escapeShell
+	}
+	return escapeHTMLSpec
+}
+
+func escapeHTMLSpec(s string) string {
+	// Spec expects &quot; for double quotes; Go's html.EscapeString outputs &#34;
+	// We can use html.EscapeString then replace numeric entity with &quot;
+	esc := html.EscapeString(s)
+	esc = strings.ReplaceAll(esc, "&#34;", "&quot;")
+	return esc
+}
+
+func escapeJSON(s string) string {
+	return escapeString(s, "")
+}
+
+func escapeJS(s string) string {
+	// Quotes and <, > and & are written as \uXXXX so a value can neither end
+	// the string literal nor a surrounding <script> element or attribute.
+	return escapeString(s, "\"'`<>&")
+}
+
+// escapeString backslash-escapes s for a JSON or JavaScript string literal.
+// Backslashes, double quotes, control characters and the line terminators
+// U+2028 and U+2029 (valid in JSON but not in older JavaScript) are always
+// escaped, the ASCII characters in hex as \uXXXX sequences.
+func escapeString(s string, hex string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '"' && hex == "":
+			b.WriteString(`\"`)
+		case r < 0x20 || r == 0x7f || r == '\u2028' || r == '\u2029' || r == '"' || (r < utf8.RuneSelf && strings.ContainsRune(hex, r)):
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+func escapeCSV(s string) string {
+	if s == "" || (!strings.ContainsAny(s, ",\"\r\n") && s[0] != ' ' && s[len(s)-1] != ' ') {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+func escapeShell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// escapeWriter escapes everything written to it before passing it on. It is
+// only used with escapers that work character by character, so output can be
+// streamed in arbitrary chunks.
+type escapeWriter struct {
+	w      io.Writer
+	escape Escaper
+}
+
+func (e escapeWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(e.w, e.escape(string(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,71 @@
+package mustachio
+
+import "testing"
+
+func TestEscapeModes(t *testing.T) {
+	value := "it's \"<a&b>\"\n\\ x,y"
+	cases := []struct {
+		mode     EscapeMode
+		expected string
+	}{
+		{EscapeHTML, "it&#39;s &quot;&lt;a&amp;b&gt;&quot;\n\\ x,y"},
+		{EscapeNone, value},
+		{EscapeJSON, `it's \"<a&b>\"\n\\ x,y`},
+		{EscapeJS, `it\u0027s \u0022\u003ca\u0026b\u003e\u0022\n\\ x,y`},
+		{EscapeURL, "it%27s+%22%3Ca%26b%3E%22%0A%5C+x%2Cy"},
+		{EscapeCSV, "\"it's \"\"<a&b>\"\"\n\\ x,y\""},
+		{EscapeShell, `'it'\''s "<a&b>"` + "\n" + `\ x,y'`},
+	}
+	for _, tc := range cases {
+		tpl, err := Compile("{{v}}|{{{v}}}", WithEscapeMode(tc.mode))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Render(map[string]any{"v": value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tc.expected + "|" + value; out != want {
+			t.Errorf("mode %d: got %q want %q", tc.mode, out, want)
+		}
+	}
+}
+
+func TestEscapeCSVOnlyQuotesWhenNeeded(t *testing.T) {
+	tpl, err := Compile("{{#rows}}{{a}},{{b}}\n{{/rows}}", WithEscapeMode(EscapeCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Render(map[string]any{"rows": []any{
+		map[string]any{"a": "plain", "b": 12},
+		map[string]any{"a": "x, y", "b": " pad"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "plain,12\n\"x, y\",\" pad\"\n" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestCustomEscaperSeesWholeLambdaValue(t *testing.T) {
+	var calls []string
+	esc := func(s string) string {
+		calls = append(calls, s)
+		return "[" + s + "]"
+	}
+	tpl, err := Compile("{{greeting}} {{name}}", WithEscaper(esc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Render(map[string]any{
+		"name":     "Bob",
+		"greeting": func() string { return "hi {{{name}}}!" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "[hi Bob!] [Bob]" || len(calls) != 2 {
+		t.Fatalf("got %q after calls %q", out, calls)
+	}
+}
@@ -0,0 +1,756 @@
+package mustachio
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// Contextual escaping (EscapeHTMLContextual) follows the HTML parser state
+// through the text of a template at compile time, like html/template does,
+// and picks the escaper for each {{name}} tag from the state it is found in.
+
+// SafeHTML is trusted markup. It is written unescaped where element content
+// is expected in contextual escaping mode.
+type SafeHTML string
+
+// SafeURL is a trusted URL. It is exempt from scheme filtering in URL
+// attributes in contextual escaping mode, but still attribute-escaped.
+type SafeURL string
+
+// SafeJS is a trusted JavaScript expression. It is written unescaped in
+// script code in contextual escaping mode.
+type SafeJS string
+
+// SafeCSS is trusted CSS. It is written unescaped in style sheets and style
+// attributes in contextual escaping mode.
+type SafeCSS string
+
+// unsafeReplacement replaces values that cannot be made safe in their
+// context, such as a javascript: URL in an href attribute.
+const unsafeReplacement = "ZmustachioZ"
+
+type htmlContext uint8
+
+const (
+	ctxText        htmlContext = iota // element content
+	ctxRCDATA                         // <title> or <textarea> content
+	ctxScript                         // <script> content
+	ctxStyle                          // <style> content
+	ctxComment                        // <!-- ... -->
+	ctxTag                            // inside a tag, outside attribute values
+	ctxAfterName                      // after an attribute name, before =
+	ctxBeforeValue                    // after =, before the attribute value
+	ctxAttr                           // inside an attribute value
+)
+
+type htmlElement uint8
+
+const (
+	elemNone htmlElement = iota
+	elemScript
+	elemStyle
+	elemTitle
+	elemTextarea
+)
+
+var elementNames = map[htmlElement]string{
+	elemScript:   "script",
+	elemStyle:    "style",
+	elemTitle:    "title",
+	elemTextarea: "textarea",
+}
+
+type attrKind uint8
+
+const (
+	attrNormal attrKind = iota
+	attrURL
+	attrJS
+	attrCSS
+	attrHTML // a document, as in srcdoc
+)
+
+// urlAttrs are the attributes whose value is a URL.
+var urlAttrs = map[string]bool{
+	"action": true, "background": true, "cite": true, "codebase": true, "data": true,
+	"formaction": true, "href": true, "icon": true, "longdesc": true, "manifest": true,
+	"poster": true, "profile": true, "src": true, "usemap": true, "xlink:href": true,
+}
+
+type attrDelim uint8
+
+const (
+	delimNone attrDelim = iota
+	delimDouble
+	delimSingle
+)
+
+type jsState uint8
+
+const (
+	jsCode jsState = iota
+	jsDoubleQuote
+	jsSingleQuote
+	jsTemplate
+	jsLineComment
+	jsBlockComment
+	jsRegexp
+	jsRegexpClass // inside [...] in a regular expression
+	jsAmbiguous   // at a / that may start a division or a regular expression
+)
+
+// jsCtx is what a / in JavaScript code means at a point.
+type jsCtx uint8
+
+const (
+	jsCtxRegexp  jsCtx = iota // it starts a regular expression
+	jsCtxDivOp                // it is the division operator
+	jsCtxUnknown              // either, depending on data
+)
+
+type urlPart uint8
+
+const (
+	urlStart   urlPart = iota // nothing written yet, the scheme is still open
+	urlPath                   // before any ? or #
+	urlQuery                  // after ? or #
+	urlUnknown                // either urlStart or urlPath, depending on data
+)
+
+// htmlState is the HTML parser state at a point of a template.
+type htmlState struct {
+	ctx   htmlContext
+	elem  htmlElement // element of the current tag, or of the raw text we are in
+	attr  attrKind
+	delim attrDelim
+	js    jsState
+	jsCtx jsCtx
+	url   urlPart
+}
+
+func (s htmlState) String() string {
+	names := [...]string{"text", "RCDATA", "script", "style", "comment", "tag", "after attribute name", "before attribute value", "attribute value"}
+	return names[s.ctx]
+}
+
+// contextualize records the HTML state on every node of nodes that depends
+// on it, starting from state s, and returns the state after the nodes. src is
+// the source the nodes were parsed from, for errors.
+func contextualize(src string, nodes []node, s htmlState) (htmlState, error) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *textNode:
+			var i int
+			if s, i = advanceHTML(s, n.text); s.js == jsAmbiguous {
+				return s, newParseError(src, n.offset+i, n.offset+i+1,
+					"'/' could start a division or a regular expression")
+			}
+		case *varNode:
+			if n.unescaped {
+				// raw output is trusted not to change the context
+				continue
+			}
+			if s.ctx == ctxBeforeValue {
+				s = htmlState{ctx: ctxAttr, elem: s.elem, attr: s.attr, delim: delimNone}
+			}
+			at := s
+			n.html = &at
+			if s.ctx == ctxAttr && s.attr == attrURL && s.url == urlStart {
+				s.url = urlPath
+			}
+			if s.inJSCode() {
+				s.jsCtx = jsCtxDivOp
+			}
+		case *sectionNode:
+			start := s
+			n.html = &start
+			end, err := contextualize(src, n.children, s)
+			if err != nil {
+				return s, err
+			}
+			if s, err = joinStates(src, n.pos, n.name, start, end); err != nil {
+				return s, err
+			}
+			s = s.afterDynamic()
+		case *blockNode:
+			start := s
+			n.html = &start
+			end, err := contextualize(src, n.children, s)
+			if err != nil {
+				return s, err
+			}
+			if s, err = joinStates(src, n.pos, n.name, start, end); err != nil {
+				return s, err
+			}
+			s = s.afterDynamic()
+		case *partialNode:
+			at := s
+			n.html = &at
+			s = s.afterDynamic()
+		case *parentNode:
+			// block overrides are contextualized where they are expanded
+			at := s
+			n.html = &at
+			s = s.afterDynamic()
+		}
+	}
+	return s, nil
+}
+
+// joinStates returns the state after a section or block that starts in start
+// and whose content ends in end. Since the content may be rendered any number
+// of times, both must agree, except for how far into a URL we are.
+func joinStates(src string, pos Position, name string, start, end htmlState) (htmlState, error) {
+	if s, ok := sameState(start, end); ok {
+		return s, nil
+	}
+	tagEnd := lineEnd(src, pos.Offset)
+	if i := strings.Index(src[pos.Offset:tagEnd], name); i >= 0 {
+		tagEnd = pos.Offset + i + len(name)
+	}
+	return start, newParseError(src, pos.Offset, tagEnd,
+		fmt.Sprintf("%s starts in HTML %s but its content ends in HTML %s", name, start, end))
+}
+
+// sameState reports whether text starting in state start and ending in end
+// can be followed by text escaped for start, and returns the state to
+// continue in.
+func sameState(start, end htmlState) (htmlState, bool) {
+	a, b := start, end
+	if a.url != b.url {
+		if a.url == urlQuery || b.url == urlQuery {
+			return a, false
+		}
+		a.url, b.url = urlUnknown, urlUnknown
+	}
+	if a.jsCtx != b.jsCtx {
+		a.jsCtx, b.jsCtx = jsCtxUnknown, jsCtxUnknown
+	}
+	return a, a == b
+}
+
+// inJSCode reports whether s is in JavaScript code, outside of literals and
+// comments.
+func (s htmlState) inJSCode() bool {
+	return (s.ctx == ctxScript || s.ctx == ctxAttr && s.attr == attrJS) && s.js == jsCode
+}
+
+// afterDynamic returns the state after a section, block or partial starting
+// in s. Lambdas, partials and block overrides may end JavaScript code in a
+// different token than the template text does, so a / after them could be
+// either a division or a regular expression.
+func (s htmlState) afterDynamic() htmlState {
+	if s.inJSCode() {
+		s.jsCtx = jsCtxUnknown
+	}
+	return s
+}
+
+// advanceHTML returns the state after text, starting in state s, and the
+// number of bytes consumed. It stops early only at an ambiguous / in
+// JavaScript code, with s.js set to jsAmbiguous.
+func advanceHTML(s htmlState, text string) (htmlState, int) {
+	i := 0
+	for i < len(text) && s.js != jsAmbiguous {
+		var n int
+		s, n = stepHTML(s, text[i:])
+		i += n
+	}
+	return s, i
+}
+
+// stepHTML consumes at least one byte of t, unless it stops at an ambiguous /,
+// and returns the new state and the number of bytes consumed.
+func stepHTML(s htmlState, t string) (htmlState, int) {
+	switch s.ctx {
+	case ctxText:
+		i := strings.IndexByte(t, '<')
+		if i < 0 {
+			return s, len(t)
+		}
+		if strings.HasPrefix(t[i:], "<!--") {
+			return htmlState{ctx: ctxComment}, i + 4
+		}
+		rest := t[i+1:]
+		end := false
+		if strings.HasPrefix(rest, "/") {
+			rest, end = rest[1:], true
+		}
+		name := tagName(rest)
+		if name == "" {
+			return s, i + 1
+		}
+		next := htmlState{ctx: ctxTag}
+		if !end {
+			for e, n := range elementNames {
+				if strings.EqualFold(name, n) {
+					next.elem = e
+				}
+			}
+		}
+		return next, len(t) - len(rest) + len(name)
+	case ctxRCDATA, ctxScript, ctxStyle:
+		i := indexEndTag(t, elementNames[s.elem])
+		code := t
+		if i >= 0 {
+			code = t[:i]
+		}
+		if s.ctx == ctxScript {
+			var n int
+			if s, n = advanceJS(s, code); s.js == jsAmbiguous {
+				return s, n
+			}
+		}
+		if i < 0 {
+			return s, len(t)
+		}
+		return htmlState{ctx: ctxTag}, i + 2 + len(elementNames[s.elem])
+	case ctxComment:
+		i := strings.Index(t, "-->")
+		if i < 0 {
+			return s, len(t)
+		}
+		return htmlState{ctx: ctxText}, i + 3
+	case ctxTag:
+		i := skipHTMLSpace(t)
+		if i == len(t) {
+			return s, i
+		}
+		switch t[i] {
+		case '>':
+			return contentState(s.elem), i + 1
+		case '/':
+			return s, i + 1
+		}
+		j := i
+		for j < len(t) && !isHTMLSpace(t[j]) && t[j] != '=' && t[j] != '>' && t[j] != '/' {
+			j++
+		}
+		if j == i {
+			// a stray '=' in a tag
+			j++
+		}
+		s.ctx, s.attr = ctxAfterName, attrKindOf(strings.ToLower(t[i:j]))
+		return s, j
+	case ctxAfterName:
+		i := skipHTMLSpace(t)
+		if i == len(t) {
+			return s, i
+		}
+		if t[i] == '=' {
+			s.ctx = ctxBeforeValue
+			return s, i + 1
+		}
+		s.ctx = ctxTag
+		return s, i
+	case ctxBeforeValue:
+		i := skipHTMLSpace(t)
+		if i == len(t) {
+			return s, i
+		}
+		s.ctx, s.js, s.jsCtx, s.url = ctxAttr, jsCode, jsCtxRegexp, urlStart
+		switch t[i] {
+		case '"':
+			s.delim = delimDouble
+			return s, i + 1
+		case '\'':
+			s.delim = delimSingle
+			return s, i + 1
+		case '>':
+			return contentState(s.elem), i + 1
+		}
+		s.delim = delimNone
+		return s, i
+	case ctxAttr:
+		var i int
+		switch s.delim {
+		case delimDouble:
+			i = strings.IndexByte(t, '"')
+		case delimSingle:
+			i = strings.IndexByte(t, '\'')
+		default:
+			i = strings.IndexAny(t, " \t\n\f\r>")
+		}
+		value := t
+		if i >= 0 {
+			value = t[:i]
+		}
+		// the browser decodes character references before it runs or
+		// follows the value
+		decoded := html.UnescapeString(value)
+		switch s.attr {
+		case attrJS:
+			var n int
+			if s, n = advanceJS(s, decoded); s.js == jsAmbiguous {
+				if decoded != value {
+					// n is an offset into decoded, not t
+					n = 0
+				}
+				return s, n
+			}
+		case attrURL:
+			s.url = advanceURL(s.url, decoded)
+		}
+		if i < 0 {
+			return s, len(t)
+		}
+		next := htmlState{ctx: ctxTag, elem: s.elem}
+		if s.delim == delimNone {
+			return next, i
+		}
+		return next, i + 1
+	}
+	return s, len(t)
+}
+
+// attrKindOf returns the kind of the value of the attribute with the lower
+// case name.
+func attrKindOf(name string) attrKind {
+	switch {
+	case strings.HasPrefix(name, "on"):
+		return attrJS
+	case name == "style":
+		return attrCSS
+	case name == "srcdoc":
+		return attrHTML
+	case urlAttrs[name]:
+		return attrURL
+	}
+	return attrNormal
+}
+
+// contentState is the state after the > of a start tag of elem.
+func contentState(elem htmlElement) htmlState {
+	switch elem {
+	case elemScript:
+		return htmlState{ctx: ctxScript, elem: elem}
+	case elemStyle:
+		return htmlState{ctx: ctxStyle, elem: elem}
+	case elemTitle, elemTextarea:
+		return htmlState{ctx: ctxRCDATA, elem: elem}
+	}
+	return htmlState{ctx: ctxText}
+}
+
+func tagName(s string) string {
+	i := 0
+	for i < len(s) && (s[i] >= 'a' && s[i] <= 'z' || s[i] >= 'A' && s[i] <= 'Z' || i > 0 && (s[i] >= '0' && s[i] <= '9' || s[i] == '-')) {
+		i++
+	}
+	return s[:i]
+}
+
+// indexEndTag returns the index of the end tag </name in s, ignoring case.
+func indexEndTag(s, name string) int {
+	for i := 0; i+2+len(name) <= len(s); i++ {
+		if s[i] == '<' && s[i+1] == '/' && strings.EqualFold(s[i+2:i+2+len(name)], name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+func skipHTMLSpace(s string) int {
+	i := 0
+	for i < len(s) && isHTMLSpace(s[i]) {
+		i++
+	}
+	return i
+}
+
+// regexpPrecederKeywords are the keywords after which a / starts a regular
+// expression rather than a division.
+var regexpPrecederKeywords = map[string]bool{
+	"break": true, "case": true, "continue": true, "delete": true, "do": true,
+	"else": true, "finally": true, "in": true, "instanceof": true, "return": true,
+	"throw": true, "try": true, "typeof": true, "void": true,
+}
+
+// advanceJS tracks string and regular expression literals and comments
+// through JavaScript code, and whether a / in code starts a regular
+// expression. It returns the new state and the number of bytes consumed,
+// which is less than len(code) only at an ambiguous /.
+func advanceJS(s htmlState, code string) (htmlState, int) {
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch s.js {
+		case jsCode:
+			switch {
+			case c == '/' && i+1 < len(code) && code[i+1] == '/':
+				s.js, i = jsLineComment, i+1
+			case c == '/' && i+1 < len(code) && code[i+1] == '*':
+				s.js, i = jsBlockComment, i+1
+			case c == '/':
+				switch s.jsCtx {
+				case jsCtxRegexp:
+					s.js = jsRegexp
+				case jsCtxDivOp:
+					s.jsCtx = jsCtxRegexp
+				default:
+					s.js = jsAmbiguous
+					return s, i
+				}
+			case c == '"':
+				s.js = jsDoubleQuote
+			case c == '\'':
+				s.js = jsSingleQuote
+			case c == '`':
+				s.js = jsTemplate
+			case c == '+' || c == '-':
+				// x++ / 2 divides, x + /re/ does not
+				if i+1 < len(code) && code[i+1] == c {
+					s.jsCtx, i = jsCtxDivOp, i+1
+				} else {
+					s.jsCtx = jsCtxRegexp
+				}
+			case c == ')' || c == ']':
+				s.jsCtx = jsCtxDivOp
+			case isJSIdent(c):
+				j := i + 1
+				for j < len(code) && (isJSIdent(code[j]) || c >= '0' && c <= '9' && code[j] == '.') {
+					j++
+				}
+				s.jsCtx = jsCtxDivOp
+				if regexpPrecederKeywords[code[i:j]] {
+					s.jsCtx = jsCtxRegexp
+				}
+				i = j - 1
+			case !isJSSpace(c):
+				s.jsCtx = jsCtxRegexp
+			}
+		case jsDoubleQuote, jsSingleQuote, jsTemplate:
+			if c == '\\' {
+				i++
+			} else if c == "\"'`"[s.js-jsDoubleQuote] {
+				s.js, s.jsCtx = jsCode, jsCtxDivOp
+			}
+		case jsRegexp:
+			switch c {
+			case '\\':
+				i++
+			case '[':
+				s.js = jsRegexpClass
+			case '/':
+				s.js, s.jsCtx = jsCode, jsCtxDivOp
+			}
+		case jsRegexpClass:
+			switch c {
+			case '\\':
+				i++
+			case ']':
+				s.js = jsRegexp
+			}
+		case jsLineComment:
+			if c == '\n' {
+				s.js = jsCode
+			}
+		case jsBlockComment:
+			if c == '*' && i+1 < len(code) && code[i+1] == '/' {
+				s.js, i = jsCode, i+1
+			}
+		}
+	}
+	return s, len(code)
+}
+
+// isJSIdent reports whether c may be part of an identifier, keyword or
+// number. Non-ASCII bytes are taken to be letters.
+func isJSIdent(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c >= utf8.RuneSelf
+}
+
+func isJSSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+}
+
+func advanceURL(u urlPart, value string) urlPart {
+	switch {
+	case value == "":
+		return u
+	case u == urlQuery || strings.ContainsAny(value, "?#"):
+		return urlQuery
+	case u == urlUnknown:
+		return urlUnknown
+	}
+	return urlPath
+}
+
+// escape escapes a value for the HTML state it is interpolated in.
+func (s *htmlState) escape(v any) string {
+	str := toString(v)
+	switch s.ctx {
+	case ctxText:
+		if h, ok := v.(SafeHTML); ok {
+			return string(h)
+		}
+		return escapeHTMLSpec(str)
+	case ctxRCDATA, ctxComment:
+		return escapeHTMLSpec(str)
+	case ctxScript:
+		return escapeJSValue(s.js, v)
+	case ctxStyle:
+		return escapeCSSValue(v)
+	case ctxTag, ctxAfterName:
+		return filterAttrName(str)
+	}
+	switch s.attr {
+	case attrURL:
+		str = escapeURLValue(s.url, v)
+	case attrJS:
+		str = escapeJSValue(s.js, v)
+	case attrCSS:
+		str = escapeCSSValue(v)
+	case attrHTML:
+		// escaped once for the document and once more for the attribute
+		if h, ok := v.(SafeHTML); ok {
+			str = string(h)
+		} else {
+			str = escapeHTMLSpec(str)
+		}
+	}
+	if s.delim == delimNone {
+		return escapeUnquotedAttr(str)
+	}
+	return escapeHTMLSpec(str)
+}
+
+// escapeJSValue writes v as the content of a string literal inside one, or as
+// a JSON value in code. Values in comments are dropped.
+func escapeJSValue(js jsState, v any) string {
+	switch js {
+	case jsDoubleQuote, jsSingleQuote:
+		return escapeJS(toString(v))
+	case jsTemplate:
+		return strings.ReplaceAll(escapeJS(toString(v)), "$", `\u0024`)
+	case jsRegexp, jsRegexpClass:
+		return escapeJSRegexp(toString(v))
+	case jsLineComment, jsBlockComment:
+		return ""
+	}
+	if code, ok := v.(SafeJS); ok {
+		return string(code)
+	}
+	if s, ok := v.(string); ok {
+		return `"` + escapeJS(s) + `"`
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "null"
+	}
+	// json.Marshal already escapes <, > and & but not the quotes
+	return strings.NewReplacer("'", `\u0027`, "`", `\u0060`).Replace(string(b))
+}
+
+// escapeJSRegexp escapes s for a regular expression literal, where it
+// matches itself.
+func escapeJSRegexp(s string) string {
+	if s == "" {
+		// keeps // from starting a comment
+		return "(?:)"
+	}
+	var b strings.Builder
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte("$()*+-./?[]^{|}", s[i]) >= 0 {
+			b.WriteString(escapeJS(s[start:i]))
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+			start = i + 1
+		}
+	}
+	b.WriteString(escapeJS(s[start:]))
+	return b.String()
+}
+
+// escapeCSSValue hex-escapes everything but a conservative set of characters,
+// so a value cannot start a function, string, comment or new declaration.
+func escapeCSSValue(v any) string {
+	if css, ok := v.(SafeCSS); ok {
+		return string(css)
+	}
+	s := toString(v)
+	var b strings.Builder
+	for _, r := range s {
+		if r < utf8.RuneSelf && !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune(" #%.,-_", r)) {
+			fmt.Fprintf(&b, `\%x `, r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// escapeURLValue filters dangerous schemes at the start of a URL, normalizes
+// its path and fully escapes values in its query or fragment.
+func escapeURLValue(part urlPart, v any) string {
+	if u, ok := v.(SafeURL); ok {
+		return normalizeURL(string(u))
+	}
+	s := toString(v)
+	switch part {
+	case urlQuery:
+		return url.QueryEscape(s)
+	case urlPath:
+		return normalizeURL(s)
+	}
+	if i := strings.IndexAny(s, ":/?#"); i >= 0 && s[i] == ':' {
+		switch strings.ToLower(s[:i]) {
+		case "http", "https", "mailto":
+		default:
+			return "#" + unsafeReplacement
+		}
+	}
+	return normalizeURL(s)
+}
+
+// normalizeURL percent-encodes the bytes of s that may not appear in a URL,
+// leaving reserved characters and existing escapes alone.
+func normalizeURL(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("-._~:/?#[]@!$&'()*+,;=%", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// filterAttrName lets through values that can only form a harmless attribute
+// name. Event handlers, style, srcdoc and URL attributes are rejected.
+func filterAttrName(s string) string {
+	if s == "" || attrKindOf(strings.ToLower(s)) != attrNormal {
+		return unsafeReplacement
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return unsafeReplacement
+		}
+	}
+	return s
+}
+
+// escapeUnquotedAttr escapes every character that could end an unquoted
+// attribute value.
+func escapeUnquotedAttr(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < utf8.RuneSelf && !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:/,;?#%+", r)) {
+			fmt.Fprintf(&b, "&#%d;", r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
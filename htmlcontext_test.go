@@ -0,0 +1,173 @@
+package mustachio
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func renderContextual(t *testing.T, src string, data any, opts ...Option) string {
+	t.Helper()
+	tpl, err := Compile(src, append([]Option{WithEscapeMode(EscapeHTMLContextual)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestContextualEscaping(t *testing.T) {
+	data := map[string]any{
+		"text":  `<b>"hi"</b>`,
+		"js":    "javascript:alert(1)",
+		"url":   "https://example.com/a b",
+		"q":     "a&b=c d",
+		"name":  `x"; alert(1); "`,
+		"num":   42,
+		"list":  []any{1, "two"},
+		"color": "red;background:url(x)",
+		"cls":   "a b>",
+		"attr":  "srcdoc",
+		"safe":  SafeHTML("<i>ok</i>"),
+		"surl":  SafeURL("javascript:void(0)"),
+		"sjs":   SafeJS("f()"),
+	}
+	cases := []struct {
+		src, expected string
+	}{
+		{"<p>{{text}}</p>", "<p>&lt;b&gt;&quot;hi&quot;&lt;/b&gt;</p>"},
+		{"<p>{{safe}}</p>", "<p><i>ok</i></p>"},
+		{"<title>{{safe}}</title>", "<title>&lt;i&gt;ok&lt;/i&gt;</title>"},
+		{`<a href="{{js}}">`, `<a href="#ZmustachioZ">`},
+		{`<a href="{{url}}">`, `<a href="https://example.com/a%20b">`},
+		{`<a href="{{surl}}">`, `<a href="javascript:void(0)">`},
+		{`<a href="/search?q={{q}}">`, `<a href="/search?q=a%26b%3Dc+d">`},
+		{`<a href="/x/{{js}}">`, `<a href="/x/javascript:alert(1)">`},
+		{`<script>var s = "{{name}}";</script>`, `<script>var s = "x\u0022; alert(1); \u0022";</script>`},
+		{`<script>var n = {{num}}, l = {{list}}, s = {{name}};</script>`, `<script>var n = 42, l = [1,"two"], s = "x\u0022; alert(1); \u0022";</script>`},
+		{`<script>f({{sjs}})</script>`, `<script>f(f())</script>`},
+		{`<script>// {{name}}` + "\n" + `</script>`, "<script>// \n</script>"},
+		{`<button onclick="go({{name}})">`, `<button onclick="go(&quot;x\u0022; alert(1); \u0022&quot;)">`},
+		{`<button onclick="var s=&quot;{{name}}&quot;">`, `<button onclick="var s=&quot;x\u0022; alert(1); \u0022&quot;">`},
+		{`<a href="/search&quest;q={{q}}">`, `<a href="/search&quest;q=a%26b%3Dc+d">`},
+		{`<style>p { color: {{color}} }</style>`, `<style>p { color: red\3b background\3a url\28 x\29  }</style>`},
+		{`<p style="color: {{color}}">`, `<p style="color: red\3b background\3a url\28 x\29 ">`},
+		{`<p class={{cls}}>`, `<p class=a&#32;b&#62;>`},
+		{`<p {{cls}}>`, `<p ZmustachioZ>`},
+		{`<iframe srcdoc="{{text}}">`, `<iframe srcdoc="&amp;lt;b&amp;gt;&amp;quot;hi&amp;quot;&amp;lt;/b&amp;gt;">`},
+		{`<iframe srcdoc="{{safe}}">`, `<iframe srcdoc="&lt;i&gt;ok&lt;/i&gt;">`},
+		{`<iframe {{attr}}="x">`, `<iframe ZmustachioZ="x">`},
+		{`<p>{{{text}}}</p>`, `<p><b>"hi"</b></p>`},
+	}
+	for _, tc := range cases {
+		if out := renderContextual(t, tc.src, data); out != tc.expected {
+			t.Errorf("%s: got %q want %q", tc.src, out, tc.expected)
+		}
+	}
+}
+
+func TestContextualEscapingSectionsAndPartials(t *testing.T) {
+	data := map[string]any{
+		"items": []any{
+			map[string]any{"href": "javascript:x", "label": "<x>"},
+			map[string]any{"href": "/ok", "label": "fine"},
+		},
+		"v": `"`,
+	}
+	partials := MapPartials{"item": `<a href="{{href}}">{{label}}</a>`}
+	out := renderContextual(t, "{{#items}}{{>item}}{{/items}}<script>x={{v}}</script>", data, WithPartials(partials))
+	want := `<a href="#ZmustachioZ">&lt;x&gt;</a><a href="/ok">fine</a><script>x="\u0022"</script>`
+	if out != want {
+		t.Fatalf("got %q want %q", out, want)
+	}
+}
+
+func TestContextualEscapingBlockOverride(t *testing.T) {
+	partials := MapPartials{"layout": "<script>{{$body}}{{/body}}</script>"}
+	out := renderContextual(t, "{{<layout}}{{$body}}x = {{v}}{{/body}}{{/layout}}",
+		map[string]any{"v": "</script>"}, WithPartials(partials))
+	if want := `<script>x = "\u003c/script\u003e"</script>`; out != want {
+		t.Fatalf("got %q want %q", out, want)
+	}
+}
+
+func TestContextualEscapingMismatch(t *testing.T) {
+	_, err := Compile("{{#open}}<a href=\"{{/open}}x\">", WithEscapeMode(EscapeHTMLContextual))
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected *ParseError, got %v", err)
+	}
+	if !strings.Contains(perr.Msg, "open starts in HTML text") || perr.Line != 1 || perr.Column != 1 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := Compile(`<a href="/x{{#q}}?q={{q}}{{/q}}">`, WithEscapeMode(EscapeHTMLContextual)); err == nil {
+		t.Fatal("expected an error for a section ending in the query")
+	}
+	// a section may end at another point of the same URL path
+	if _, err := Compile(`<a href="{{#abs}}https://x{{/abs}}/p">`, WithEscapeMode(EscapeHTMLContextual)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContextualEscapingPartialChangingContext(t *testing.T) {
+	data := map[string]any{
+		"v":      "alert(document.cookie)",
+		"lambda": func(string) string { return "<script>" },
+	}
+	partials := MapPartials{"open": "<script>", "ok": "<b>{{v}}</b>"}
+	for src, want := range map[string]string{
+		"{{>open}}var x = {{v}};</script>":    "open:1:9: template starts in HTML text but ends in HTML script",
+		"{{#lambda}}{{/lambda}}var x = {{v}}": `1:1: lambda "lambda": 1:9: template starts in HTML text but ends in HTML script`,
+	} {
+		tpl, err := Compile(src, WithEscapeMode(EscapeHTMLContextual), WithPartials(partials))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tpl.Render(data)
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Fatalf("%s: expected *ParseError, got %q, %v", src, out, err)
+		}
+		if err.Error() != want {
+			t.Errorf("%s: got %q want %q", src, err.Error(), want)
+		}
+	}
+
+	// partials that end where they start are fine
+	out := renderContextual(t, "{{>ok}}", data, WithPartials(partials))
+	if want := "<b>alert(document.cookie)</b>"; out != want {
+		t.Fatalf("got %q want %q", out, want)
+	}
+}
+
+func TestContextualEscapingJSRegexp(t *testing.T) {
+	data := map[string]any{"u": `"+alert(1)+"`, "re": "a.b/c", "empty": "", "n": 4}
+	cases := []struct {
+		src, expected string
+	}{
+		{`<script>var r = /"/; var x = "{{u}}";</script>`, `<script>var r = /"/; var x = "\u0022+alert(1)+\u0022";</script>`},
+		{`<script>var r = /[/"]/g; var x = "{{u}}";</script>`, `<script>var r = /[/"]/g; var x = "\u0022+alert(1)+\u0022";</script>`},
+		{`<script>var r = a / 2 / b; var x = "{{u}}";</script>`, `<script>var r = a / 2 / b; var x = "\u0022+alert(1)+\u0022";</script>`},
+		{`<script>var r = {{n}} / 2, x = "{{u}}";</script>`, `<script>var r = 4 / 2, x = "\u0022+alert(1)+\u0022";</script>`},
+		{`<script>i++ / 2; return /"/.test("{{u}}");</script>`, `<script>i++ / 2; return /"/.test("\u0022+alert(1)+\u0022");</script>`},
+		{`<script>var r = /{{re}}/, e = /{{empty}}/;</script>`, `<script>var r = /a\.b\/c/, e = /(?:)/;</script>`},
+	}
+	for _, tc := range cases {
+		if out := renderContextual(t, tc.src, data); out != tc.expected {
+			t.Errorf("%s: got %q want %q", tc.src, out, tc.expected)
+		}
+	}
+
+	// what a / after a section means depends on the data
+	_, err := Compile("<script>{{#a}}x{{/a}} / 2</script>", WithEscapeMode(EscapeHTMLContextual))
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected *ParseError, got %v", err)
+	}
+	if perr.Msg != "'/' could start a division or a regular expression" || perr.Line != 1 || perr.Column != 23 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
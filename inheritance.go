@@ -0,0 +1,108 @@
+package mustachio
+
+import (
+	"io"
+	"strings"
+)
+
+// Template inheritance (optional spec module):
+//
+//	{{<parent}}{{$title}}My page{{/title}}{{/parent}}
+//
+// renders the partial "parent" with its {{$title}}...{{/title}} block replaced
+// by "My page". Overrides given further out take precedence over those given
+// by the parents themselves, so the outermost template has the last word.
+
+// parentNode renders a partial with block overrides. Any content of the tag
+// other than blocks is ignored.
+type parentNode struct {
+	name    string
+	dynamic bool
+	indent  string
+	blocks  map[string]*blockNode
+	pos     Position
+	html    *htmlState
+}
+
+func (pn *parentNode) render(w io.Writer, p ValueProvider, st *renderState) error {
+	ast, name, err := loadPartial(pn.name, pn.dynamic, pn.indent, pn.pos, pn.html, p, st)
+	if ast == nil || err != nil {
+		return err
+	}
+	inner, err := st.enter(name, pn.pos)
+	if err != nil {
+		return err
+	}
+	inner.blocks = make(map[string]*blockNode, len(st.blocks)+len(pn.blocks))
+	for name, b := range pn.blocks {
+		inner.blocks[name] = b
+	}
+	for name, b := range st.blocks {
+		inner.blocks[name] = b
+	}
+	return ast.render(w, p, inner)
+}
+
+// blockNode is a named region that renders its own content unless a parent
+// tag further out overrides it.
+type blockNode struct {
+	name     string
+	children []node
+	// The content source and its delimiters, so an override can be parsed
+	// again to fit the block it replaces.
+	raw    string
+	delims delimiters
+	// If the opening tag is standalone, indent is the indentation of the
+	// first content line (or of the tag itself when there is no content).
+	standalone bool
+	indent     string
+	pos        Position
+	html       *htmlState
+}
+
+func (b *blockNode) render(w io.Writer, p ValueProvider, st *renderState) error {
+	o, ok := st.blocks[b.name]
+	if !ok {
+		return renderChildren(w, p, st, b.children)
+	}
+	// Block indentation is removed where the override is defined and added
+	// where it is expanded.
+	indent := ""
+	if b.standalone {
+		indent = b.indent
+	}
+	raw := o.raw
+	if o.standalone && o.indent != indent {
+		raw = applyIndent(dedent(o.raw, o.indent), indent)
+	} else if b.html == nil {
+		return renderChildren(w, p, st, o.children)
+	}
+	// In contextual escaping mode, the override is always parsed again to
+	// escape it for where it ends up rather than where it was written.
+	ast, err := parseIn(raw, o.delims, b.html)
+	if err != nil {
+		return err
+	}
+	return ast.render(w, p, st)
+}
+
+func leadingWhitespace(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] != ' ' && s[i] != '\t' {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// dedent removes indent from the start of every line of s that begins with it.
+func dedent(s, indent string) string {
+	if indent == "" {
+		return s
+	}
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, indent)
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,102 @@
+package mustachio
+
+import "testing"
+
+func TestInheritance(t *testing.T) {
+	cases := []struct {
+		name     string
+		data     any
+		template string
+		partials MapPartials
+		expected string
+	}{
+		{"default", nil, "{{$title}}Default title{{/title}}\n", nil, "Default title\n"},
+		{"variable", map[string]any{"bar": "baz"}, "{{$foo}}default {{bar}} content{{/foo}}\n", nil, "default baz content\n"},
+		{"inherit", nil, "{{<include}}{{/include}}\n", MapPartials{"include": "{{$foo}}default content{{/foo}}"}, "default content"},
+		{"overridden content", nil, "{{<super}}{{$title}}sub template title{{/title}}{{/super}}",
+			MapPartials{"super": "...{{$title}}Default title{{/title}}..."}, "...sub template title..."},
+		{"data does not override block", map[string]any{"var": "var in data"},
+			"{{<include}}{{$var}}var in template{{/var}}{{/include}}",
+			MapPartials{"include": "{{$var}}var in include{{/var}}"}, "var in template"},
+		{"two overridden parents", nil,
+			"test {{<parent}}{{$stuff}}override1{{/stuff}}{{/parent}} {{<parent}}{{$stuff}}override2{{/stuff}}{{/parent}}\n",
+			MapPartials{"parent": "|{{$stuff}}...{{/stuff}}{{$default}} default{{/default}}|"},
+			"test |override1 default| |override2 default|\n"},
+		{"override parent with newlines", nil, "{{<parent}}{{$ballmer}}\npeaked\n\n:(\n{{/ballmer}}{{/parent}}",
+			MapPartials{"parent": "{{$ballmer}}peaking{{/ballmer}}"}, "peaked\n\n:(\n"},
+		{"only one override", nil, "{{<parent}}{{$stuff2}}override two{{/stuff2}}{{/parent}}",
+			MapPartials{"parent": "{{$stuff}}new default one{{/stuff}}, {{$stuff2}}new default two{{/stuff2}}"},
+			"new default one, override two"},
+		{"parent as partial", nil, "{{>parent}}|{{<parent}}{{/parent}}",
+			MapPartials{"parent": "{{$foo}}default content{{/foo}}"}, "default content|default content"},
+		{"recursion", nil, "{{<parent}}{{$foo}}override{{/foo}}{{/parent}}",
+			MapPartials{
+				"parent":  "{{$foo}}default content{{/foo}} {{$bar}}{{<parent2}}{{/parent2}}{{/bar}}",
+				"parent2": "{{$foo}}parent2 default content{{/foo}} {{<parent}}{{$bar}}don't recurse{{/bar}}{{/parent}}",
+			}, "override override override don't recurse"},
+		{"multi-level", nil, "{{<parent}}{{$a}}c{{/a}}{{/parent}}",
+			MapPartials{
+				"parent":      "{{<older}}{{$a}}p{{/a}}{{/older}}",
+				"older":       "{{<grandParent}}{{$a}}o{{/a}}{{/grandParent}}",
+				"grandParent": "{{$a}}g{{/a}}",
+			}, "c"},
+		{"multi-level without child override", nil, "{{<parent}}{{/parent}}",
+			MapPartials{
+				"parent":      "{{<older}}{{$a}}p{{/a}}{{/older}}",
+				"older":       "{{<grandParent}}{{$a}}o{{/a}}{{/grandParent}}",
+				"grandParent": "{{$a}}g{{/a}}",
+			}, "p"},
+		{"text inside parent", nil, "{{<parent}} asdfasd {{$foo}}hmm{{/foo}} asdfasdfasdf {{/parent}}",
+			MapPartials{"parent": "{{$foo}}default content{{/foo}}"}, "hmm"},
+		{"block scope", map[string]any{"fruit": "apples", "nested": map[string]any{"fruit": "bananas"}},
+			"{{<parent}}{{$block}}I say {{fruit}}.{{/block}}{{/parent}}",
+			MapPartials{"parent": "{{#nested}}{{$block}}You say {{fruit}}.{{/block}}{{/nested}}"}, "I say bananas."},
+		{"override inside partial", nil, "{{<layout}}{{$footer}}bye{{/footer}}{{/layout}}",
+			MapPartials{"layout": "<{{>footer}}>", "footer": "{{$footer}}default{{/footer}}"}, "<bye>"},
+		{"standalone parent", nil, "Hi,\n  {{<parent}}{{/parent}}\n", MapPartials{"parent": "one\ntwo\n"}, "Hi,\n  one\n  two\n"},
+		{"standalone block", nil, "{{<parent}}{{$block}}\none\ntwo\n{{/block}}{{/parent}}\n",
+			MapPartials{"parent": "Hi,\n  {{$block}}{{/block}}\n"}, "Hi,\n  one\n  two\n"},
+		{"block reindentation", nil, "{{<parent}}{{$block}}\n    one\n    two\n{{/block}}{{/parent}}\n",
+			MapPartials{"parent": "Hi,\n  {{$block}}\n  {{/block}}\n"}, "Hi,\n  one\n  two\n"},
+		{"intrinsic indentation", nil, "{{<parent}}{{$block}}\none\ntwo\n{{/block}}{{/parent}}\n",
+			MapPartials{"parent": "Hi,\n{{$block}}\n    default\n{{/block}}\n"}, "Hi,\n    one\n    two\n"},
+		{"nested block reindentation", nil, "{{<parent}}{{$nested}}\nthree\n{{/nested}}{{/parent}}\n",
+			MapPartials{
+				"parent":      "{{<grandparent}}{{$block}}\n  one\n  {{$nested}}\n    two\n  {{/nested}}\n{{/block}}{{/grandparent}}\n",
+				"grandparent": "{{$block}}default{{/block}}",
+			}, "one\n  three\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := Render(tc.template, tc.data, tc.partials)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != tc.expected {
+				t.Fatalf("got %q want %q", out, tc.expected)
+			}
+		})
+	}
+}
+
+func TestStandaloneLinesWithSeveralTags(t *testing.T) {
+	partials := MapPartials{"p": "P", "q": "Q", "parent": "[{{$b}}{{/b}}]"}
+	cases := []struct{ template, expected string }{
+		// only parent and block tags may share a standalone line
+		{"a\n{{#x}}{{/x}}\nb", "a\n\nb"},
+		{"a\n  {{>p}}{{>q}}\nb", "a\n  PQ\nb"},
+		{"a\n{{! c }}{{=<% %>=}}\nb", "a\n\nb"},
+		{"a\n{{! c }}{{<parent}}{{/parent}}\nb", "a\n[]\nb"},
+		{"a\n  {{<parent}}{{$b}}x{{/b}}{{/parent}}\nb", "a\n  [x]\nb"},
+		{"a\n{{<parent}}{{$b}}\nx\n{{/b}}{{/parent}}\nb", "a\n[x\n]b"},
+	}
+	for _, tc := range cases {
+		out, err := Render(tc.template, nil, partials)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != tc.expected {
+			t.Errorf("%q: got %q want %q", tc.template, out, tc.expected)
+		}
+	}
+}
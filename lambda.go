@@ -0,0 +1,257 @@
+package mustachio
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"runtime/debug"
+)
+
+// Lambdas are Go funcs in the data. Variable lambdas are
+//
+//	func() string
+//	func() (string, error)
+//
+// and section lambdas are
+//
+//	func(text string) string
+//	func(text string, render func(string) string) string
+//
+// where the results may again be (string, error) and the render callback may
+// be a func(string) (string, error). Any of them may take a context.Context
+// first. Both kinds may also be a func(LambdaContext) string or
+// func(LambdaContext) (string, error). A returned error or a panic fails the
+// render with a *LambdaError.
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// lambdaArgs returns the leading context argument for a lambda of type t that
+// takes a context.Context first, and the number of its other parameters.
+func lambdaArgs(t reflect.Type, st *renderState) ([]reflect.Value, int) {
+	if t.NumIn() > 0 && t.In(0) == contextType {
+		return []reflect.Value{reflect.ValueOf(&st.ctx).Elem()}, t.NumIn() - 1
+	}
+	return nil, t.NumIn()
+}
+
+// returnsText reports whether a func of type t returns a string, optionally
+// followed by an error.
+func returnsText(t reflect.Type) bool {
+	switch t.NumOut() {
+	case 1:
+		return t.Out(0).Kind() == reflect.String
+	case 2:
+		return t.Out(0).Kind() == reflect.String && t.Out(1) == errorType
+	}
+	return false
+}
+
+// callLambda calls the lambda fn with args and returns its text, turning a
+// returned error or a panic into a *LambdaError.
+func callLambda(fn reflect.Value, args []reflect.Value, name string, pos Position, st *renderState) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &LambdaError{Template: st.name, Name: name, Position: pos, Panic: r, Stack: debug.Stack()}
+		}
+	}()
+	res := fn.Call(args)
+	if len(res) == 2 && !res[1].IsNil() {
+		return "", &LambdaError{Template: st.name, Name: name, Position: pos, Err: res[1].Interface().(error)}
+	}
+	return res[0].String(), nil
+}
+
+func tryCallZeroArgLambda(v any, name string, pos Position, st *renderState) (string, bool, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || rv.Kind() != reflect.Func {
+		return "", false, nil
+	}
+	args, n := lambdaArgs(rv.Type(), st)
+	if n != 0 || !returnsText(rv.Type()) {
+		return "", false, nil
+	}
+	str, err := callLambda(rv, args, name, pos, st)
+	return str, true, err
+}
+
+var (
+	renderFuncType    = reflect.TypeOf((func(string) string)(nil))
+	renderErrFuncType = reflect.TypeOf((func(string) (string, error))(nil))
+)
+
+func tryCallSectionLambda(w io.Writer, v any, s *sectionNode, p ValueProvider, st *renderState) (bool, error) {
+	lc := lambdaContext{name: s.name, pos: s.pos, raw: s.raw, section: true, delims: s.delims, html: s.html, p: p, st: st}
+	if str, called, err := tryCallContextLambda(v, lc); called {
+		if err != nil {
+			return true, err
+		}
+		_, err = io.WriteString(w, str)
+		return true, err
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || rv.Kind() != reflect.Func || !returnsText(rv.Type()) {
+		return false, nil
+	}
+	args, n := lambdaArgs(rv.Type(), st)
+	off := len(args)
+	in := func(i int) reflect.Type { return rv.Type().In(off + i) }
+	if n < 1 || n > 2 || in(0).Kind() != reflect.String {
+		return false, nil
+	}
+	args = append(args, reflect.ValueOf(s.raw).Convert(in(0)))
+	if n == 1 {
+		// func(string) string: the result is rendered in place of the section
+		str, err := callLambda(rv, args, s.name, s.pos, st)
+		if err != nil {
+			return true, err
+		}
+		ast, err := parseIn(str, s.delims, s.html)
+		if err != nil {
+			return true, &LambdaError{Template: st.name, Name: s.name, Position: s.pos, Err: err}
+		}
+		return true, ast.render(w, p, st)
+	}
+	// func(string, func(string) string) string: the result is written as is.
+	// The callback has to hand its result back to the lambda, so it is the one
+	// place where rendering goes through a buffer.
+	render := func(text string) (string, error) {
+		ast, err := parseIn(text, s.delims, s.html)
+		if err != nil {
+			return "", err
+		}
+		return renderBuffered(ast, p, st)
+	}
+	// A callback without an error result keeps the first error to itself and
+	// fails the render once the lambda returns.
+	var renderErr error
+	var callback reflect.Value
+	switch {
+	case renderErrFuncType.ConvertibleTo(in(1)):
+		callback = reflect.ValueOf(render).Convert(in(1))
+	case renderFuncType.ConvertibleTo(in(1)):
+		callback = reflect.ValueOf(func(text string) string {
+			out, err := render(text)
+			if err != nil && renderErr == nil {
+				renderErr = err
+			}
+			return out
+		}).Convert(in(1))
+	default:
+		return false, nil
+	}
+	str, err := callLambda(rv, append(args, callback), s.name, s.pos, st)
+	if err == nil {
+		err = renderErr
+	}
+	if err != nil {
+		return true, err
+	}
+	_, err = io.WriteString(w, str)
+	return true, err
+}
+
+// LambdaContext gives a lambda of the form
+//
+//	func(ctx mustachio.LambdaContext) (string, error)
+//
+// (or returning only a string) access to the render it is called from. Its
+// result is not rendered again: a section lambda's result is written as is
+// and a variable lambda's result is escaped like any other value. Use Render
+// to expand template text.
+type LambdaContext interface {
+	// Context returns the context of the render.
+	Context() context.Context
+	// Name returns the name the lambda was looked up by.
+	Name() string
+	// Position returns the position of the tag.
+	Position() Position
+	// Lookup resolves a name in the current context stack. Lazy values are
+	// called; one that fails is reported as not found.
+	Lookup(name string) (any, bool)
+	// Raw returns the unrendered content of the section, or "" for a
+	// variable lambda.
+	Raw() string
+	// Render renders text against the current context stack.
+	Render(text string) (string, error)
+	// RenderWith renders text with data pushed onto the context stack.
+	RenderWith(text string, data any) (string, error)
+	// Delimiters returns the delimiters Render parses with: those in effect
+	// at a section tag, or the default ones for variable lambdas.
+	Delimiters() (otag, ctag string)
+	// Escape escapes s as a {{name}} value at the tag would be.
+	Escape(s string) string
+	// Partials returns the partial loader of the render, or nil.
+	Partials() PartialLoaderContext
+}
+
+var lambdaContextType = reflect.TypeOf((*LambdaContext)(nil)).Elem()
+
+type lambdaContext struct {
+	name    string
+	pos     Position
+	raw     string
+	section bool
+	delims  delimiters
+	html    *htmlState // the HTML state at the tag in contextual escaping mode
+	p       ValueProvider
+	st      *renderState
+}
+
+func (c *lambdaContext) Context() context.Context       { return c.st.ctx }
+func (c *lambdaContext) Name() string                   { return c.name }
+func (c *lambdaContext) Position() Position             { return c.pos }
+func (c *lambdaContext) Raw() string                    { return c.raw }
+func (c *lambdaContext) Delimiters() (string, string)   { return c.delims.otag, c.delims.ctag }
+func (c *lambdaContext) Partials() PartialLoaderContext { return c.st.partials }
+
+func (c *lambdaContext) Lookup(name string) (any, bool) {
+	val, ok, err := lookup(c.p, name, c.pos, c.st)
+	return val, ok && err == nil
+}
+
+func (c *lambdaContext) Render(text string) (string, error) {
+	return c.render(text, c.p)
+}
+
+func (c *lambdaContext) RenderWith(text string, data any) (string, error) {
+	return c.render(text, c.p.Push(data))
+}
+
+func (c *lambdaContext) render(text string, p ValueProvider) (string, error) {
+	// The output of a variable lambda is escaped as a whole afterwards.
+	var html *htmlState
+	if c.section {
+		html = c.html
+	}
+	ast, err := parseIn(text, c.delims, html)
+	if err != nil {
+		return "", err
+	}
+	return renderBuffered(ast, p, c.st)
+}
+
+func (c *lambdaContext) Escape(s string) string {
+	if c.html != nil {
+		return c.html.escape(s)
+	}
+	return c.st.escape(s)
+}
+
+// tryCallContextLambda calls v if it is a func(LambdaContext) lambda.
+func tryCallContextLambda(v any, lc lambdaContext) (string, bool, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || rv.Kind() != reflect.Func {
+		return "", false, nil
+	}
+	if t := rv.Type(); t.NumIn() != 1 || t.In(0) != lambdaContextType || !returnsText(t) {
+		return "", false, nil
+	}
+	c := new(lambdaContext)
+	*c = lc
+	var arg LambdaContext = c
+	str, err := callLambda(rv, []reflect.Value{reflect.ValueOf(&arg).Elem()}, lc.name, lc.pos, lc.st)
+	return str, true, err
+}
@@ -0,0 +1,88 @@
+package mustachio
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLambdaContext(t *testing.T) {
+	data := map[string]any{
+		"locale": "de",
+		"price":  12.5,
+		"user":   map[string]any{"name": "Ann"},
+		"money": func(lc LambdaContext) (string, error) {
+			price, _ := lc.Lookup("price")
+			if locale, _ := lc.Lookup("locale"); locale == "de" {
+				return strings.Replace(fmt.Sprintf("%.2f €", price), ".", ",", 1), nil
+			}
+			return fmt.Sprintf("€%.2f", price), nil
+		},
+		"greet": func(lc LambdaContext) (string, error) {
+			user, _ := lc.Lookup("user")
+			return lc.RenderWith(strings.TrimSpace(lc.Raw()), user)
+		},
+		"twice": func(lc LambdaContext) (string, error) {
+			out, err := lc.Render(lc.Raw())
+			return out + out, err
+		},
+		"info": func(lc LambdaContext) string {
+			otag, ctag := lc.Delimiters()
+			return fmt.Sprintf("%s %s%s %v %s", lc.Name(), otag, ctag, lc.Position(), lc.Escape("<&>"))
+		},
+		"raw": func(lc LambdaContext) string { return "<" + lc.Raw() + ">" },
+	}
+	src := "{{money}} {{#greet}} Hi {{name}} {{/greet}} {{#twice}}{{locale}}{{/twice}} {{{info}}}\n" +
+		"{{=<% %>=}}<%#info%><%/info%> <%{raw}%> <%#raw%><%x%><%/raw%>"
+	tpl, err := Compile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "12,50 € Hi Ann dede info {{}} 1:76 &lt;&amp;&gt;\n" +
+		"info <%%> 2:12 &lt;&amp;&gt; <> <<%x%>>"
+	if out != want {
+		t.Fatalf("got  %q\nwant %q", out, want)
+	}
+}
+
+func TestLambdaContextEscapeAndPartials(t *testing.T) {
+	partials := remotePartials{"p": "partial"}
+	data := map[string]any{
+		"esc": func(lc LambdaContext) string { return lc.Escape(`"a b"`) },
+		"load": func(lc LambdaContext) (string, error) {
+			return lc.Partials().LoadPartial(lc.Context(), "p")
+		},
+		"v": `"`,
+	}
+	tpl, err := Compile(`{{#esc}}{{/esc}} <a href="/?q={{#esc}}{{/esc}}">{{load}}</a>`,
+		WithEscapeMode(EscapeHTMLContextual), WithPartialsContext(partials))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.RenderContext(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `&quot;a b&quot; <a href="/?q=%22a+b%22">partial</a>`; out != want {
+		t.Fatalf("got %q want %q", out, want)
+	}
+}
+
+func TestSectionLambdaAlternateDelimiters(t *testing.T) {
+	data := map[string]any{
+		"planet": "Earth",
+		"lambda": func(text string) string { return text + "{{planet}} => |planet|" + text },
+	}
+	out, err := Render("{{= | | =}}<|#lambda|-|/lambda|>", data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "<-{{planet}} => Earth->" {
+		t.Fatalf("got %q", out)
+	}
+}
@@ -0,0 +1,67 @@
+package mustachio
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var errLambda = errors.New("no rate available")
+
+func TestLambdaErrors(t *testing.T) {
+	data := map[string]any{
+		"ok":    func() (string, error) { return "{{v}}", nil },
+		"fail":  func() (string, error) { return "", errLambda },
+		"boom":  func() string { panic("kaboom") },
+		"wrap":  func(s string) (string, error) { return "<" + s + ">", nil },
+		"sfail": func(s string) (string, error) { return "", errLambda },
+		"bad":   func(s string) string { return "{{#x}}" },
+		"cb": func(s string, render func(string) (string, error)) (string, error) {
+			out, err := render(s)
+			return "[" + out + "]", err
+		},
+		"plain": func(s string, render func(string) string) string { return render(s) },
+		"v":     "V",
+	}
+	tpl, err := Compile("{{ok}}|{{#wrap}}{{v}}{{/wrap}}|{{#cb}}{{v}}{{/cb}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := tpl.Render(data); err != nil || out != "V|<V>|[V]" {
+		t.Fatalf("got %q, %v", out, err)
+	}
+
+	cases := []struct {
+		src, msg string
+		err      error
+		panics   bool
+	}{
+		{"a\n {{fail}}", `t:2:2: lambda "fail": no rate available`, errLambda, false},
+		{"{{#sfail}}x{{/sfail}}", `t:1:1: lambda "sfail": no rate available`, errLambda, false},
+		{"{{boom}}", `t:1:1: lambda "boom" panicked: kaboom`, nil, true},
+		{"{{#bad}}{{/bad}}", `t:1:1: lambda "bad": 1:1: unclosed section x`, nil, false},
+		{"{{#cb}}{{fail}}{{/cb}}", `t:1:1: lambda "cb": t:1:1: lambda "fail": no rate available`, errLambda, false},
+		{"{{#plain}}{{boom}}{{/plain}}", `t:1:1: lambda "boom" panicked: kaboom`, nil, true},
+	}
+	for _, tc := range cases {
+		tpl, err := Compile(tc.src, WithName("t"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tpl.Render(data)
+		var lerr *LambdaError
+		if !errors.As(err, &lerr) {
+			t.Errorf("%s: expected *LambdaError, got %v", tc.src, err)
+			continue
+		}
+		if err.Error() != tc.msg {
+			t.Errorf("%s: got %q want %q", tc.src, err.Error(), tc.msg)
+		}
+		if tc.err != nil && !errors.Is(err, tc.err) {
+			t.Errorf("%s: error does not wrap %v", tc.src, tc.err)
+		}
+		if tc.panics && (lerr.Panic == nil || !strings.Contains(string(lerr.Stack), "goroutine")) {
+			t.Errorf("%s: panic not recorded: %#v", tc.src, lerr)
+		}
+	}
+}
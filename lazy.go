@@ -0,0 +1,66 @@
+package mustachio
+
+import (
+	"reflect"
+	"runtime/debug"
+)
+
+// Lazy values are zero-argument funcs in the data that return something other
+// than a string (which would make them lambdas), optionally with an error:
+//
+//	func() []Order
+//	func() (map[string]any, error)
+//
+// They are called when a template looks them up, and their result is used as
+// ordinary data, so it is only computed if the template needs it.
+
+// lazyError stands in for a lazy value whose func failed, so that the error
+// reaches the tag that looked it up. Its Name and Position are left unset.
+type lazyError struct{ err *LambdaError }
+
+// resolveLazy returns the value of v if it is a lazy value, and v otherwise.
+func resolveLazy(v any) any {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Func {
+		return v
+	}
+	t := rv.Type()
+	if t.NumIn() != 0 || t.NumOut() == 0 || t.NumOut() > 2 ||
+		t.Out(0).Kind() == reflect.String || t.Out(0) == errorType ||
+		t.NumOut() == 2 && t.Out(1) != errorType {
+		return v
+	}
+	if rv.IsNil() {
+		return nil
+	}
+	return callLazy(rv)
+}
+
+func callLazy(fn reflect.Value) (v any) {
+	defer func() {
+		if r := recover(); r != nil {
+			v = lazyError{&LambdaError{Panic: r, Stack: debug.Stack()}}
+		}
+	}()
+	res := fn.Call(nil)
+	if len(res) == 2 && !res[1].IsNil() {
+		return lazyError{&LambdaError{Err: res[1].Interface().(error)}}
+	}
+	return res[0].Interface()
+}
+
+// lookup looks up the name of the tag at pos, resolving lazy values even if
+// p does not. A lazy value that fails is reported as a *LambdaError.
+func lookup(p ValueProvider, name string, pos Position, st *renderState) (any, bool, error) {
+	val, ok := p.Lookup(name)
+	if !ok {
+		return nil, false, nil
+	}
+	val = resolveLazy(val)
+	if le, failed := val.(lazyError); failed {
+		err := *le.err
+		err.Template, err.Name, err.Position = st.name, name, pos
+		return nil, true, &err
+	}
+	return val, true, nil
+}
@@ -0,0 +1,67 @@
+package mustachio
+
+import (
+	"errors"
+	"testing"
+)
+
+type order struct {
+	ID    int
+	Total float64
+}
+
+func TestLazyValues(t *testing.T) {
+	calls := 0
+	data := map[string]any{
+		"orders": func() []order {
+			calls++
+			return []order{{1, 9.5}, {2, 20}}
+		},
+		"user": func() (map[string]any, error) {
+			return map[string]any{"name": "Ann", "tags": func() []any { return []any{"a", "b"} }}, nil
+		},
+		"none":   func() []any { return nil },
+		"unused": func() any { t.Error("unused lazy value called"); return nil },
+		"count":  func() int { return 3 },
+	}
+	tpl, err := Compile("{{#orders}}{{ID}}:{{Total}} {{/orders}}|{{user.name}} {{#user}}{{#tags}}{{.}}{{/tags}}{{/user}}|" +
+		"{{^none}}no items{{/none}}|{{count}}|{{orders.1.ID}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "1:9.5 2:20 |Ann ab|no items|3|2" {
+		t.Fatalf("got %q", out)
+	}
+	if calls != 2 {
+		t.Fatalf("orders called %d times", calls)
+	}
+}
+
+func TestLazyValueErrors(t *testing.T) {
+	errDB := errors.New("db down")
+	data := map[string]any{
+		"rows":  func() ([]any, error) { return nil, errDB },
+		"user":  func() (map[string]any, error) { return nil, errDB },
+		"panic": func() []any { panic("oops") },
+	}
+	cases := []struct{ src, msg string }{
+		{"{{#rows}}x{{/rows}}", `t:1:1: lambda "rows": db down`},
+		{"x{{user.name}}", `t:1:2: lambda "user.name": db down`},
+		{"{{^panic}}{{/panic}}", `t:1:1: lambda "panic" panicked: oops`},
+	}
+	for _, tc := range cases {
+		tpl, err := Compile(tc.src, WithName("t"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tpl.Render(data)
+		var lerr *LambdaError
+		if !errors.As(err, &lerr) || err.Error() != tc.msg {
+			t.Errorf("%s: got %v want %s", tc.src, err, tc.msg)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package mustachio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Limits bounds the resources a render may use, for templates from untrusted
+// authors. A zero field means no limit, except for MaxPartialDepth.
+type Limits struct {
+	// MaxPartialDepth is the maximum number of nested partial and parent
+	// inclusions, which stops a partial that includes itself. Zero means
+	// DefaultMaxPartialDepth, which also applies without WithLimits, and a
+	// negative value means no limit.
+	MaxPartialDepth int
+	// MaxSectionDepth is the maximum number of nested sections, counting
+	// those in partials.
+	MaxSectionDepth int
+	// MaxIterations is the maximum number of list items rendered by all
+	// sections together.
+	MaxIterations int
+	// MaxOutputBytes is the maximum number of bytes written.
+	MaxOutputBytes int64
+	// Timeout is the maximum duration of a render. It is checked between
+	// nodes and list items, so a slow lambda or writer can exceed it.
+	Timeout time.Duration
+}
+
+// DefaultMaxPartialDepth is the partial depth of renders that do not set
+// Limits.MaxPartialDepth. It is deep enough for recursive partials over any
+// reasonable tree, and stops a partial including itself over cyclic data
+// before it overflows the stack.
+const DefaultMaxPartialDepth = 1000
+
+// The errors wrapped by a *LimitError, one per limit.
+var (
+	ErrMaxPartialDepth = errors.New("partials nested too deeply")
+	ErrMaxSectionDepth = errors.New("sections nested too deeply")
+	ErrMaxIterations   = errors.New("too many iterations")
+	ErrMaxOutputBytes  = errors.New("output too large")
+	ErrTimeout         = errors.New("render timed out")
+)
+
+// LimitError is returned when a render exceeds one of its Limits. Use
+// errors.Is with ErrMaxPartialDepth and friends to tell which one.
+type LimitError struct {
+	Template string // template or partial being rendered
+	Position        // position of the tag that hit the limit, if any
+	Limit    int64  // the limit that was exceeded (in nanoseconds for timeouts)
+	Err      error
+}
+
+func (e *LimitError) Error() string {
+	msg := fmt.Sprintf("%v (limit %d)", e.Err, e.Limit)
+	if e.Line > 0 {
+		msg = e.Position.String() + ": " + msg
+	}
+	if e.Template != "" {
+		msg = e.Template + ":" + msg
+	}
+	return msg
+}
+
+func (e *LimitError) Unwrap() error { return e.Err }
+
+// limiter tracks the resources used by one render.
+type limiter struct {
+	Limits
+	deadline   time.Time
+	iterations int
+	written    int64 // bytes written or buffered for lambdas
+}
+
+func newLimiter(l Limits) *limiter {
+	if l == (Limits{}) {
+		return nil
+	}
+	lim := &limiter{Limits: l}
+	if l.Timeout > 0 {
+		lim.deadline = time.Now().Add(l.Timeout)
+	}
+	return lim
+}
+
+func (st *renderState) limitError(pos Position, limit int64, err error) error {
+	return &LimitError{Template: st.name, Position: pos, Limit: limit, Err: err}
+}
+
+// check fails once the context of the render is done or the render has
+// taken longer than its timeout.
+func (st *renderState) check() error {
+	if st.done != nil {
+		select {
+		case <-st.done:
+			return st.ctx.Err()
+		default:
+		}
+	}
+	if st.limits == nil || st.limits.deadline.IsZero() || time.Now().Before(st.limits.deadline) {
+		return nil
+	}
+	return st.limitError(Position{}, int64(st.limits.Timeout), ErrTimeout)
+}
+
+// iterate counts a list item rendered by the section at pos.
+func (st *renderState) iterate(pos Position) error {
+	if st.limits != nil {
+		st.limits.iterations++
+		if max := st.limits.MaxIterations; max > 0 && st.limits.iterations > max {
+			return st.limitError(pos, int64(max), ErrMaxIterations)
+		}
+	}
+	return st.check()
+}
+
+// enterSection returns the state for the content of the section at pos.
+func (st *renderState) enterSection(pos Position) (*renderState, error) {
+	if st.limits == nil || st.limits.MaxSectionDepth == 0 {
+		return st, nil
+	}
+	if st.sectionDepth >= st.limits.MaxSectionDepth {
+		return nil, st.limitError(pos, int64(st.limits.MaxSectionDepth), ErrMaxSectionDepth)
+	}
+	inner := *st
+	inner.sectionDepth++
+	return &inner, nil
+}
+
+// limitOutput returns w limited to the output budget of the render, which all
+// writers it returns share.
+func (st *renderState) limitOutput(w io.Writer) io.Writer {
+	if st.limits == nil || st.limits.MaxOutputBytes == 0 {
+		return w
+	}
+	return &limitWriter{w: w, lim: st.limits}
+}
+
+// renderBuffered renders ast into a string for a lambda. The text counts
+// against the output budget while it is buffered, so the buffer cannot grow
+// past it; the budget is given back once the lambda has the text, and its
+// result counts when it is written.
+func renderBuffered(ast *rootNode, p ValueProvider, st *renderState) (string, error) {
+	var b strings.Builder
+	err := ast.render(st.limitOutput(&b), p, st)
+	if st.limits != nil && st.limits.MaxOutputBytes > 0 {
+		st.limits.written -= int64(b.Len())
+	}
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// limitWriter fails writes beyond the remaining byte budget of a render.
+type limitWriter struct {
+	w   io.Writer
+	lim *limiter
+}
+
+func (lw *limitWriter) Write(b []byte) (int, error) {
+	left := lw.lim.MaxOutputBytes - lw.lim.written
+	if int64(len(b)) <= left {
+		n, err := lw.w.Write(b)
+		lw.lim.written += int64(n)
+		return n, err
+	}
+	n, err := lw.w.Write(b[:max(left, 0)])
+	lw.lim.written += int64(n)
+	if err == nil {
+		err = &LimitError{Limit: lw.lim.MaxOutputBytes, Err: ErrMaxOutputBytes}
+	}
+	return n, err
+}
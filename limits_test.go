@@ -0,0 +1,128 @@
+package mustachio
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimits(t *testing.T) {
+	cyclic := map[string]any{"name": "root"}
+	cyclic["child"] = cyclic
+	partials := MapPartials{"tree": "{{name}}{{#child}}({{>tree}}){{/child}}"}
+	nested := strings.Repeat("{{#a}}", 5) + strings.Repeat("{{/a}}", 5)
+	cases := []struct {
+		name   string
+		src    string
+		data   any
+		limits Limits
+		err    error
+		msg    string
+	}{
+		{"partial depth", "{{>tree}}", cyclic, Limits{MaxPartialDepth: 3}, ErrMaxPartialDepth,
+			"tree:1:20: partials nested too deeply (limit 3)"},
+		{"section depth", nested, map[string]any{"a": true}, Limits{MaxSectionDepth: 4}, ErrMaxSectionDepth,
+			"t:1:25: sections nested too deeply (limit 4)"},
+		{"iterations", "{{#a}}{{#b}}.{{/b}}{{/a}}", map[string]any{"a": []int{1, 2}, "b": []any{1, 2, 3}},
+			Limits{MaxIterations: 7}, ErrMaxIterations, "t:1:7: too many iterations (limit 7)"},
+		{"output", "{{#a}}abc{{/a}}", map[string]any{"a": []int{1, 2, 3}}, Limits{MaxOutputBytes: 8}, ErrMaxOutputBytes,
+			"output too large (limit 8)"},
+	}
+	for _, tc := range cases {
+		tpl, err := Compile(tc.src, WithName("t"), WithPartials(partials), WithLimits(tc.limits))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tpl.Render(tc.data)
+		var lerr *LimitError
+		if !errors.As(err, &lerr) || !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected *LimitError wrapping %v, got %v", tc.name, tc.err, err)
+			continue
+		}
+		if err.Error() != tc.msg {
+			t.Errorf("%s: got %q want %q", tc.name, err.Error(), tc.msg)
+		}
+	}
+}
+
+func TestLimitsWithinBounds(t *testing.T) {
+	tpl, err := Compile("{{#a}}{{#b}}.{{/b}}{{/a}}", WithLimits(Limits{
+		MaxSectionDepth: 2, MaxIterations: 8, MaxOutputBytes: 6, Timeout: time.Minute,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		out, err := tpl.Render(map[string]any{"a": []int{1, 2}, "b": []any{1, 2, 3}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "......" {
+			t.Fatalf("got %q", out)
+		}
+	}
+}
+
+func TestLimitsTimeout(t *testing.T) {
+	slow := func() string { time.Sleep(20 * time.Millisecond); return "" }
+	tpl, err := Compile("{{#items}}{{slow}}{{/items}}", WithLimits(Limits{Timeout: 30 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err = tpl.Execute(io.Discard, map[string]any{"items": make([]any, 100), "slow": slow})
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("render took %v", d)
+	}
+}
+
+func TestLimitsOutputInsideLambdas(t *testing.T) {
+	big := make([]any, 100000)
+	data := map[string]any{
+		"big":  big,
+		"wrap": func(text string, render func(string) string) string { return "<" + render(text) + ">" },
+		"ctx":  func(c LambdaContext) (string, error) { return c.Render(c.Raw()) },
+		"lazy": func() string { return "{{#big}}xxxxxxxxxx{{/big}}" },
+	}
+	for _, src := range []string{
+		"{{#wrap}}{{#big}}xxxxxxxxxx{{/big}}{{/wrap}}",
+		"{{#ctx}}{{#big}}xxxxxxxxxx{{/big}}{{/ctx}}",
+		"{{lazy}}",
+	} {
+		tpl, err := Compile(src, WithLimits(Limits{MaxOutputBytes: 10}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tpl.Render(data); !errors.Is(err, ErrMaxOutputBytes) {
+			t.Errorf("%s: expected ErrMaxOutputBytes, got %v", src, err)
+		}
+	}
+
+	// text buffered for a lambda does not count twice
+	tpl, err := Compile("ab{{#wrap}}{{#big}}x{{/big}}{{/wrap}}", WithLimits(Limits{MaxOutputBytes: 6}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Render(map[string]any{"big": []int{1, 2}, "wrap": data["wrap"]})
+	if err != nil || out != "ab<xx>" {
+		t.Fatalf("got %q, %v", out, err)
+	}
+}
+
+func TestDefaultMaxPartialDepth(t *testing.T) {
+	cyclic := map[string]any{}
+	cyclic["child"] = cyclic
+	tpl, err := Compile("{{>tree}}", WithPartials(MapPartials{"tree": "{{#child}}{{>tree}}{{/child}}"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lerr *LimitError
+	if _, err := tpl.Render(cyclic); !errors.As(err, &lerr) || lerr.Limit != DefaultMaxPartialDepth {
+		t.Fatalf("expected *LimitError for the default partial depth, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package mustachio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type remotePartials map[string]string
+
+var errUnavailable = errors.New("backend unavailable")
+
+func (r remotePartials) LoadPartial(ctx context.Context, name string) (string, error) {
+	if ctx == nil {
+		return "", errors.New("no context")
+	}
+	if name == "down" {
+		return "", errUnavailable
+	}
+	src, ok := r[name]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", name, ErrPartialNotFound)
+	}
+	return src, nil
+}
+
+func TestPartialLoaderContext(t *testing.T) {
+	partials := remotePartials{"page": "<{{>layout}}>", "layout": "[{{title}}{{>nope}}]"}
+	tpl, err := Compile("{{>page}}", WithPartialsContext(partials))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Render(map[string]any{"title": "T"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "<[T]>" {
+		t.Fatalf("got %q", out)
+	}
+
+	tpl, err = Compile("{{>nope}}", WithPartialsContext(partials), WithStrictPartials())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var missing *MissingPartialError
+	if _, err := tpl.Render(nil); !errors.As(err, &missing) || missing.Name != "nope" {
+		t.Fatalf("expected *MissingPartialError, got %v", err)
+	}
+}
+
+func TestPartialLoaderContextError(t *testing.T) {
+	partials := remotePartials{"page": "{{<layout}}{{$body}}x{{/body}}{{/layout}}", "layout": "a\n  {{>down}}"}
+	tpl, err := Compile("{{>page}}", WithName("main"), WithPartialsContext(partials))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Render(nil)
+	var perr *PartialError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected *PartialError, got %v", err)
+	}
+	if !errors.Is(err, errUnavailable) {
+		t.Errorf("error does not wrap the loader error: %v", err)
+	}
+	want := `main > page > layout:2:3: loading partial "down": backend unavailable`
+	if err.Error() != want {
+		t.Errorf("got %q want %q", err.Error(), want)
+	}
+}
+
+func TestAdaptPartialLoader(t *testing.T) {
+	loader := AdaptPartialLoader(MapPartials{"a": "A"})
+	if src, err := loader.LoadPartial(context.Background(), "a"); src != "A" || err != nil {
+		t.Fatalf("got %q, %v", src, err)
+	}
+	if _, err := loader.LoadPartial(context.Background(), "b"); !errors.Is(err, ErrPartialNotFound) {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package mustachio
+
+import "reflect"
+
+// NewMemoMapProvider returns a MapProvider that remembers what it looks up,
+// per context frame and name, so lazy values and struct methods are called
+// at most once for each frame even if the template uses them many times.
+//
+// The cache lives as long as the provider, so create one per render, and the
+// data must not change during the render. Variable and section lambdas are
+// still called every time; they may rely on that.
+func NewMemoMapProvider(root any) *MapProvider {
+	m := &memo{values: make(map[memoKey]any), live: make(map[pointerID]any)}
+	return &MapProvider{stack: []any{root}, memo: m, frames: []any{m.frameID(root)}}
+}
+
+// memo is the cache shared by a memoizing MapProvider and all providers
+// pushed from it.
+type memo struct {
+	values map[memoKey]any
+	pushes int
+	// live holds on to the maps and pointers identified by their address, so
+	// the garbage collector cannot free one and hand its address to a new
+	// frame while the cache has values for it.
+	live map[pointerID]any
+}
+
+type memoKey struct {
+	frame any // see frameID
+	name  string
+}
+
+// pointerID identifies a context frame by the map or pointer it holds.
+type pointerID struct {
+	typ reflect.Type
+	ptr uintptr
+}
+
+// frameID returns the identity of a context frame: maps and pointers are
+// identified by their address, so pushing the same one again (e.g. the same
+// list item in two sections) reuses its cached values. Other values get a new
+// identity every time they are pushed.
+func (m *memo) frameID(ctx any) any {
+	rv := reflect.ValueOf(ctx)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Pointer:
+		id := pointerID{rv.Type(), rv.Pointer()}
+		if _, ok := m.live[id]; !ok {
+			m.live[id] = ctx
+		}
+		return id
+	}
+	m.pushes++
+	return m.pushes
+}
@@ -0,0 +1,99 @@
+package mustachio
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+type profile struct {
+	calls *int
+}
+
+func (p profile) AvatarURL() string {
+	*p.calls++
+	return "/a.png"
+}
+
+func TestMemoize(t *testing.T) {
+	lazyCalls, methodCalls, lambdaCalls := 0, 0, 0
+	item := map[string]any{"price": func() float64 { lazyCalls++; return 2.5 }}
+	data := map[string]any{
+		"user":  map[string]any{"profile": profile{&methodCalls}},
+		"items": []any{item, item},
+		"stats": func() map[string]any { lazyCalls++; return map[string]any{"n": 7} },
+		"tick":  func() string { lambdaCalls++; return "t" },
+	}
+	src := strings.Repeat("{{user.profile.AvatarURL}}", 5) +
+		"{{#items}}{{price}}{{price}}{{/items}}{{stats.n}}{{#stats}}{{n}}{{/stats}}{{tick}}{{tick}}"
+	tpl, err := Compile(src, WithMemoize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		out, err := tpl.Render(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strings.Repeat("/a.png", 5) + "2.52.52.52.577tt"; out != want {
+			t.Fatalf("got %q want %q", out, want)
+		}
+		// once per render for the method, the shared item and stats
+		if methodCalls != i || lazyCalls != 2*i || lambdaCalls != 2*i {
+			t.Fatalf("render %d: calls method=%d lazy=%d lambda=%d", i, methodCalls, lazyCalls, lambdaCalls)
+		}
+	}
+}
+
+func TestMemoMapProviderFrames(t *testing.T) {
+	calls := 0
+	n := func() int { calls++; return calls }
+	// struct items have no identity, so each pushed frame is separate
+	type row struct{ N func() int }
+	p := NewMemoMapProvider(map[string]any{"rows": []row{{n}, {n}}})
+	tpl, err := Compile("{{#rows}}{{N}}{{N}}{{/rows}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.RenderProvider(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "1122" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestMemoizeFramesOutliveGC(t *testing.T) {
+	const n = 50
+	data := map[string]any{
+		"loop": func(c LambdaContext) (string, error) {
+			var b strings.Builder
+			for i := 0; i < n; i++ {
+				s, err := c.RenderWith("{{v}},", map[string]any{"v": i})
+				if err != nil {
+					return "", err
+				}
+				b.WriteString(s)
+				runtime.GC()
+			}
+			return b.String(), nil
+		},
+	}
+	tpl, err := Compile("{{#loop}}{{/loop}}", WithMemoize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&want, "%d,", i)
+	}
+	if out != want.String() {
+		t.Fatalf("got %q", out)
+	}
+}
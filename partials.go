@@ -0,0 +1,177 @@
+package mustachio
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync"
+)
+
+// FSPartials loads partials from a file system such as an embed.FS,
+// os.DirFS or fstest.MapFS. The partial name is a slash-separated path
+// relative to the root of the file system, without extension:
+// {{> emails/footer}} loads emails/footer.mustache. Names that are not valid
+// fs paths, such as ../secret or /etc/passwd, are never loaded. Use it with
+// WithPartialsContext.
+//
+// Files are read once and their parsed templates are cached, so an
+// FSPartials is meant for files that do not change while it is in use.
+// It is safe for concurrent use.
+type FSPartials struct {
+	fsys fs.FS
+	exts []string
+
+	sources sync.Map // name -> string
+	cache   astCache
+}
+
+// NewFSPartials returns a loader for the partials in fsys. For a partial
+// name, it tries each extension in turn (".mustache" if none are given); add
+// "" to also accept names that already carry their extension.
+func NewFSPartials(fsys fs.FS, exts ...string) *FSPartials {
+	if len(exts) == 0 {
+		exts = []string{".mustache"}
+	}
+	return &FSPartials{fsys: fsys, exts: exts}
+}
+
+// LoadPartial implements PartialLoaderContext. A partial that exists with
+// none of the extensions is reported as ErrPartialNotFound; other errors,
+// such as a file that cannot be read, are returned as they are.
+func (p *FSPartials) LoadPartial(ctx context.Context, name string) (string, error) {
+	if src, ok := p.sources.Load(name); ok {
+		return src.(string), nil
+	}
+	for _, ext := range p.exts {
+		path := name + ext
+		if !fs.ValidPath(path) || path == "." {
+			return "", ErrPartialNotFound
+		}
+		b, err := fs.ReadFile(p.fsys, path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		src, _ := p.sources.LoadOrStore(name, string(b))
+		return src.(string), nil
+	}
+	return "", ErrPartialNotFound
+}
+
+func (p *FSPartials) loadParsed(ctx context.Context, key partialKey, parse func(string) (*rootNode, error)) (*rootNode, error) {
+	return p.cache.get(ctx, key, p, parse)
+}
+
+// PartialSet caches the parsed partials of a loader, so that each partial is
+// parsed once per indentation, delimiters and HTML context it is included
+// with rather than on every inclusion. The parsed partials are shared by all
+// templates that use the set and all their renders.
+//
+// A PartialSet is safe for concurrent use. Call Invalidate or Reset when the
+// partials of the underlying loader change.
+type PartialSet struct {
+	loader PartialLoaderContext
+	cache  astCache
+}
+
+// NewPartialSet returns a PartialSet loading partials from loader. Use
+// AdaptPartialLoader to wrap a PartialLoader.
+func NewPartialSet(loader PartialLoaderContext) *PartialSet {
+	return &PartialSet{loader: loader}
+}
+
+// LoadPartial implements PartialLoaderContext by calling the underlying
+// loader.
+func (s *PartialSet) LoadPartial(ctx context.Context, name string) (string, error) {
+	return s.loader.LoadPartial(ctx, name)
+}
+
+// Invalidate drops the parsed versions of the named partials, so they are
+// loaded and parsed again when they are next included.
+func (s *PartialSet) Invalidate(names ...string) {
+	s.cache.invalidate(names...)
+}
+
+// Reset drops all parsed partials.
+func (s *PartialSet) Reset() {
+	s.cache.reset()
+}
+
+func (s *PartialSet) loadParsed(ctx context.Context, key partialKey, parse func(string) (*rootNode, error)) (*rootNode, error) {
+	return s.cache.get(ctx, key, s.loader, parse)
+}
+
+// astCache holds parsed partials. Its zero value is an empty cache.
+type astCache struct {
+	mu   sync.RWMutex
+	gen  uint64 // incremented on every invalidation
+	asts map[partialKey]*rootNode
+}
+
+// get returns the cached AST for key, or loads and parses the partial.
+func (c *astCache) get(ctx context.Context, key partialKey, loader PartialLoaderContext, parse func(string) (*rootNode, error)) (*rootNode, error) {
+	c.mu.RLock()
+	ast, ok := c.asts[key]
+	gen := c.gen
+	c.mu.RUnlock()
+	if ok {
+		return ast, nil
+	}
+	src, err := loader.LoadPartial(ctx, key.name)
+	if err != nil {
+		return nil, err
+	}
+	if ast, err = parse(src); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Don't store what was loaded before an invalidation.
+	if c.gen == gen {
+		if c.asts == nil {
+			c.asts = make(map[partialKey]*rootNode)
+		}
+		c.asts[key] = ast
+	}
+	return ast, nil
+}
+
+func (c *astCache) invalidate(names ...string) {
+	drop := make(map[string]bool, len(names))
+	for _, name := range names {
+		drop[name] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for key := range c.asts {
+		if drop[key.name] {
+			delete(c.asts, key)
+		}
+	}
+}
+
+func (c *astCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.asts = nil
+}
+
+// partialKey identifies a parsed partial. The same source parses differently
+// depending on where it is included.
+type partialKey struct {
+	name       string
+	indent     string
+	delims     delimiters
+	contextual bool
+	html       htmlState
+}
+
+// parsedPartials is implemented by loaders that cache parsed partials.
+// parse turns the source of the partial into its AST for the given key.
+type parsedPartials interface {
+	loadParsed(ctx context.Context, key partialKey, parse func(string) (*rootNode, error)) (*rootNode, error)
+}
@@ -0,0 +1,165 @@
+package mustachio
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// countingFS counts the files opened in it.
+type countingFS struct {
+	fs.FS
+	opens map[string]int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.opens[name]++
+	return c.FS.Open(name)
+}
+
+func TestFSPartials(t *testing.T) {
+	fsys := fstest.MapFS{
+		"header.mustache":        {Data: []byte("<h1>{{title}}</h1>\n")},
+		"emails/footer.mustache": {Data: []byte("Bye {{name}}")},
+		"page.html":              {Data: []byte("html {{name}}")},
+	}
+	partials := NewFSPartials(fsys, ".mustache", ".html")
+	tpl, err := Compile("{{>header}}{{> emails/footer}}|{{>page}}|{{>missing}}", WithPartialsContext(partials))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Render(map[string]any{"title": "Hi", "name": "Ann"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "<h1>Hi</h1>\nBye Ann|html Ann|" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestFSPartialsRejectsTraversal(t *testing.T) {
+	fsys := fstest.MapFS{"secret.mustache": {Data: []byte("secret")}}
+	partials := NewFSPartials(fsys)
+	for _, name := range []string{"../secret", "/secret", "a/../secret", "./secret"} {
+		if src, err := partials.LoadPartial(context.Background(), name); !errors.Is(err, ErrPartialNotFound) {
+			t.Errorf("%s: loaded %q, %v", name, src, err)
+		}
+	}
+	if _, err := partials.LoadPartial(context.Background(), "secret"); err != nil {
+		t.Errorf("secret: %v", err)
+	}
+}
+
+// lockedFS fails to open the files in locked.
+type lockedFS struct {
+	fs.FS
+	locked map[string]bool
+}
+
+func (l lockedFS) Open(name string) (fs.File, error) {
+	if l.locked[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return l.FS.Open(name)
+}
+
+func TestFSPartialsReadError(t *testing.T) {
+	fsys := lockedFS{fstest.MapFS{"a.mustache": {Data: []byte("A")}}, map[string]bool{"a.mustache": true}}
+	tpl, err := Compile("[{{>a}}]", WithName("page"), WithPartialsContext(NewFSPartials(fsys)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Render(nil)
+	var perr *PartialError
+	if !errors.As(err, &perr) || !errors.Is(err, fs.ErrPermission) {
+		t.Fatalf("expected *PartialError wrapping fs.ErrPermission, got %v", err)
+	}
+	if want := `page:1:2: loading partial "a": open a.mustache: permission denied`; err.Error() != want {
+		t.Errorf("got %q want %q", err.Error(), want)
+	}
+}
+
+func TestFSPartialsCachesParsedPartials(t *testing.T) {
+	fsys := &countingFS{FS: fstest.MapFS{"row.mustache": {Data: []byte("<{{n}}>\n")}}, opens: map[string]int{}}
+	partials := NewFSPartials(fsys)
+	tpl, err := Compile("{{#rows}}{{>row}}{{/rows}}\n  {{>row}}\n", WithPartialsContext(partials))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cached *rootNode
+	for i := 0; i < 3; i++ {
+		out, err := tpl.Render(map[string]any{"rows": []any{
+			map[string]any{"n": 1}, map[string]any{"n": 2}, map[string]any{"n": 3},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "<1>\n<2>\n<3>\n\n  <>\n" {
+			t.Fatalf("got %q", out)
+		}
+		ast, ok := partials.cache.asts[partialKey{name: "row", delims: delimiters{"{{", "}}"}}]
+		if !ok || (cached != nil && ast != cached) {
+			t.Fatalf("partial not cached")
+		}
+		cached = ast
+	}
+	if fsys.opens["row.mustache"] != 1 {
+		t.Fatalf("row.mustache opened %d times", fsys.opens["row.mustache"])
+	}
+}
+
+// countingLoader counts the partials loaded from it.
+type countingLoader struct {
+	MapPartials
+	loads map[string]int
+}
+
+func (c *countingLoader) LoadPartial(name string) (string, bool) {
+	c.loads[name]++
+	return c.MapPartials.LoadPartial(name)
+}
+
+func TestPartialSet(t *testing.T) {
+	loader := &countingLoader{MapPartials{"row": "[{{.}}]\n", "other": "o"}, map[string]int{}}
+	set := NewPartialSet(AdaptPartialLoader(loader))
+	src := "{{#rows}}{{>row}}{{/rows}}\n  {{>row}}\n{{=<% %>=}}<%>row%><%>other%>"
+	tpl, err := Compile(src, WithPartialsContext(set))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]any{"rows": []any{1, 2, 3, 4}}
+	render := func(want string) {
+		t.Helper()
+		out, err := tpl.Render(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != want {
+			t.Fatalf("got %q want %q", out, want)
+		}
+	}
+	want := "[1]\n[2]\n[3]\n[4]\n\n  [map[rows:[1 2 3 4]]]\n[map[rows:[1 2 3 4]]]\no"
+	render(want)
+	render(want)
+	// once at the left margin and once indented; set delimiters don't apply
+	// to partials
+	if loader.loads["row"] != 2 || loader.loads["other"] != 1 {
+		t.Fatalf("loads: %v", loader.loads)
+	}
+
+	loader.MapPartials["row"] = "({{.}})"
+	set.Invalidate("row")
+	render("(1)(2)(3)(4)\n  (map[rows:[1 2 3 4]])(map[rows:[1 2 3 4]])o")
+	if loader.loads["row"] != 4 || loader.loads["other"] != 1 {
+		t.Fatalf("loads after Invalidate: %v", loader.loads)
+	}
+
+	loader.MapPartials["other"] = "O"
+	set.Reset()
+	render("(1)(2)(3)(4)\n  (map[rows:[1 2 3 4]])(map[rows:[1 2 3 4]])O")
+	if loader.loads["other"] != 2 {
+		t.Fatalf("loads after Reset: %v", loader.loads)
+	}
+}
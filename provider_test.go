@@ -0,0 +1,63 @@
+package mustachio
+
+import (
+	"strings"
+	"testing"
+)
+
+// upperProvider resolves every name to its upper-cased form, tracking the
+// pushed contexts so that "." still works.
+type upperProvider struct {
+	stack   []any
+	lookups *[]string
+}
+
+func (u upperProvider) Lookup(name string) (any, bool) {
+	*u.lookups = append(*u.lookups, name)
+	switch name {
+	case ".":
+		return u.stack[len(u.stack)-1], true
+	case "items":
+		return []any{"a", "b"}, true
+	case "kind":
+		return "row", true
+	case "wrap":
+		return func(text string) string { return "(" + text + ")" }, true
+	case "missing":
+		return nil, false
+	}
+	return strings.ToUpper(name), true
+}
+
+func (u upperProvider) Push(ctx any) ValueProvider {
+	return upperProvider{stack: append(append([]any{}, u.stack...), ctx), lookups: u.lookups}
+}
+
+func TestRenderWithCustomProvider(t *testing.T) {
+	var lookups []string
+	p := upperProvider{stack: []any{nil}, lookups: &lookups}
+	partials := MapPartials{"row": "<{{.}}:{{name}}>"}
+	out, err := RenderProvider("{{greeting}} {{#items}}{{>*kind}}{{/items}} {{#wrap}}{{x}}{{/wrap}}{{missing}}", p, partials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "GREETING <a:NAME><b:NAME> (X)" {
+		t.Fatalf("got %q", out)
+	}
+	want := "greeting items kind . name kind . name wrap x missing"
+	if got := strings.Join(lookups, " "); got != want {
+		t.Fatalf("lookups %q want %q", got, want)
+	}
+}
+
+func TestTemplateExecuteProviderStrict(t *testing.T) {
+	var lookups []string
+	tpl, err := Compile("{{missing}}", WithStrict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.RenderProvider(upperProvider{stack: []any{nil}, lookups: &lookups})
+	if mk, ok := err.(*MissingKeyError); !ok || mk.Depth != -1 {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package mustachio
+
+import (
+	"math"
+	"reflect"
+	"runtime/debug"
+	"sync"
+)
+
+// structInfo holds the names under which the fields and methods of a struct
+// type can be looked up from a template. It is computed once per type.
+type structInfo struct {
+	fields  map[string][]int // name -> field index path, including promoted fields
+	methods map[string]int   // name -> method index on the (possibly pointer) type
+	embeds  map[string][]int // method name -> index path of the embedded field it may be promoted from
+}
+
+var structInfoCache sync.Map // reflect.Type -> *structInfo
+
+func getStructInfo(t reflect.Type) *structInfo {
+	if si, ok := structInfoCache.Load(t); ok {
+		return si.(*structInfo)
+	}
+	si := &structInfo{fields: map[string][]int{}, methods: map[string]int{}, embeds: map[string][]int{}}
+	if t.Kind() == reflect.Struct {
+		// Tag names take precedence over Go field names, and shallower
+		// fields over deeper ones, so collect tags in a first pass.
+		depth := map[string]int{}
+		for _, f := range reflect.VisibleFields(t) {
+			if !f.IsExported() {
+				continue
+			}
+			name, ok := fieldTagName(f)
+			if !ok || name == "" {
+				continue
+			}
+			if d, exists := depth[name]; exists && d <= len(f.Index) {
+				continue
+			}
+			depth[name] = len(f.Index)
+			si.fields[name] = f.Index
+		}
+		for _, f := range reflect.VisibleFields(t) {
+			if !f.IsExported() {
+				continue
+			}
+			if _, ok := fieldTagName(f); !ok {
+				continue
+			}
+			if _, exists := si.fields[f.Name]; !exists {
+				si.fields[f.Name] = f.Index
+			}
+		}
+	}
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		// m.Type includes the receiver as first argument
+		if m.IsExported() && m.Type.NumIn() == 1 && m.Type.NumOut() == 1 {
+			si.methods[m.Name] = i
+			if index := embeddedMethod(t, m.Name); index != nil {
+				si.embeds[m.Name] = index
+			}
+		}
+	}
+	actual, _ := structInfoCache.LoadOrStore(t, si)
+	return actual.(*structInfo)
+}
+
+// embeddedMethod returns the index path of the shallowest embedded field of
+// the struct (or pointer to struct) type t that has the method name, or nil.
+// Reflection cannot tell whether t declares the method itself, so this is
+// where the method is promoted from only if calling it fails.
+func embeddedMethod(t reflect.Type, name string) []int {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var index []int
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.Anonymous || index != nil && len(index) <= len(f.Index) {
+			continue
+		}
+		_, ok := f.Type.MethodByName(name)
+		if !ok && f.Type.Kind() != reflect.Pointer && f.Type.Kind() != reflect.Interface {
+			_, ok = reflect.PointerTo(f.Type).MethodByName(name)
+		}
+		if ok {
+			index = f.Index
+		}
+	}
+	return index
+}
+
+// nilEmbedded reports whether a pointer or interface on the way to the
+// embedded field at index in the struct (or pointer to struct) v is nil.
+func nilEmbedded(v reflect.Value, index []int) bool {
+	for _, i := range index {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return true
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil()
+}
+
+// callMethod calls the method i of v. A method promoted from a nil embedded
+// pointer is missing; any other panic is reported like a failed lazy value.
+func callMethod(v reflect.Value, si *structInfo, i int, name string) (val any, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if nilEmbedded(v, si.embeds[name]) {
+				val, ok = nil, false
+				return
+			}
+			val, ok = lazyError{&LambdaError{Panic: r, Stack: debug.Stack()}}, true
+		}
+	}()
+	return v.Method(i).Call(nil)[0].Interface(), true
+}
+
+// fieldTagName returns the name given to a field by its mustache tag, falling
+// back to its json tag. ok is false if the field is excluded with "-".
+func fieldTagName(f reflect.StructField) (name string, ok bool) {
+	tag, found := f.Tag.Lookup("mustache")
+	if !found {
+		tag, found = f.Tag.Lookup("json")
+	}
+	if !found {
+		return "", true
+	}
+	for i := 0; i < len(tag); i++ {
+		if tag[i] == ',' {
+			tag = tag[:i]
+			break
+		}
+	}
+	if tag == "-" {
+		return "", false
+	}
+	return tag, true
+}
+
+// lookupReflect resolves name on values the fast paths in lookupInContext do
+// not cover: structs (methods first, then fields), maps with string-like keys,
+// and slices or arrays indexed by a decimal name. Pointers and interfaces are
+// dereferenced as needed.
+func lookupReflect(v reflect.Value, name string) (any, bool) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, false
+		}
+		if v.Kind() == reflect.Pointer {
+			si := getStructInfo(v.Type())
+			if i, ok := si.methods[name]; ok {
+				return callMethod(v, si, i, name)
+			}
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		si := getStructInfo(v.Type())
+		if i, ok := si.methods[name]; ok {
+			return callMethod(v, si, i, name)
+		}
+		index, ok := si.fields[name]
+		if !ok {
+			return nil, false
+		}
+		f, err := v.FieldByIndexErr(index)
+		if err != nil {
+			// nil embedded pointer on the way to a promoted field
+			return nil, false
+		}
+		return f.Interface(), true
+	case reflect.Map:
+		kt := v.Type().Key()
+		if kt.Kind() != reflect.String {
+			return nil, false
+		}
+		e := v.MapIndex(reflect.ValueOf(name).Convert(kt))
+		if !e.IsValid() {
+			return nil, false
+		}
+		return e.Interface(), true
+	case reflect.Slice, reflect.Array:
+		idx := parseIndex(name)
+		if idx < 0 || idx >= v.Len() {
+			return nil, false
+		}
+		return v.Index(idx).Interface(), true
+	}
+	return nil, false
+}
+
+// parseIndex parses a numeric segment of a dotted name, returning -1 if s is
+// not a non-negative decimal number.
+func parseIndex(s string) int {
+	if len(s) == 0 {
+		return -1
+	}
+	idx := 0
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return -1
+		}
+		d := int(ch - '0')
+		if idx > (math.MaxInt-d)/10 {
+			// too large to index anything
+			return -1
+		}
+		idx = idx*10 + d
+	}
+	return idx
+}
+
+// asList returns the reflect.Value of v if v is a slice or array a section
+// iterates over. Byte slices are treated as strings, not lists.
+func asList(v any) (reflect.Value, bool) {
+	rv := reflect.ValueOf(v)
+	if (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Type().Elem().Kind() != reflect.Uint8 {
+		return rv, true
+	}
+	return reflect.Value{}, false
+}
+
+// isNilPointer reports whether v is a typed nil pointer, which a template
+// treats like a missing value.
+func isNilPointer(v any) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
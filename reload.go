@@ -0,0 +1,172 @@
+package mustachio
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reloader is a Set that follows the template files of a directory during
+// development. Check (or Watch, which calls it periodically) compares the
+// modification times and sizes of the files with those seen last, without
+// any file system notification mechanism, and recompiles the files that were
+// modified or added and drops those that were removed. Partials are resolved
+// when they are rendered, so the templates including a changed file need not
+// be recompiled; their references are checked again.
+//
+// When a file no longer compiles, the last good version of its template is
+// kept and the error is reported by Check and Err until the file is fixed.
+type Reloader struct {
+	*Set
+	fsys fs.FS
+	exts []string
+
+	mu    sync.Mutex
+	files map[string]fileStamp // by path
+	// problems by template name
+	compileErrs map[string]error
+	refErrs     map[string]error
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader loads the templates in fsys (typically os.DirFS of a template
+// directory) whose extension is one of exts, ".mustache" if none are given,
+// and compiles them with opts. Templates are named after their path without
+// extension, as with (*Set).ParseFS. Problems with individual templates are
+// returned as an error, but the Reloader is usable all the same.
+func NewReloader(fsys fs.FS, exts []string, opts ...Option) (*Reloader, error) {
+	if len(exts) == 0 {
+		exts = []string{".mustache"}
+	}
+	r := &Reloader{
+		Set:         NewSet(opts...),
+		fsys:        fsys,
+		exts:        exts,
+		files:       make(map[string]fileStamp),
+		compileErrs: make(map[string]error),
+		refErrs:     make(map[string]error),
+	}
+	_, err := r.Check()
+	return r, err
+}
+
+// Check looks for modified, added and removed files and updates the
+// templates. It returns the names of the templates that changed, and the
+// problems found in them and the templates including them.
+func (r *Reloader) Check() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := make(map[string]fileStamp)
+	changed := make(map[string]string)
+	err := fs.WalkDir(r.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !r.watched(p) {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stamp := fileStamp{info.ModTime(), info.Size()}
+		seen[p] = stamp
+		if old, ok := r.files[p]; ok && old == stamp {
+			return nil
+		}
+		b, err := fs.ReadFile(r.fsys, p)
+		if err != nil {
+			return err
+		}
+		changed[templateName(p)] = string(b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for p := range r.files {
+		if _, ok := seen[p]; !ok {
+			removed = append(removed, templateName(p))
+		}
+	}
+	r.files = seen
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil, nil
+	}
+
+	compileErrs, refErrs := r.Set.update(changed, removed)
+	for _, name := range removed {
+		delete(r.compileErrs, name)
+		delete(r.refErrs, name)
+	}
+	var errs []error
+	for _, name := range sortedKeys(changed) {
+		if err := compileErrs[name]; err != nil {
+			r.compileErrs[name] = err
+			errs = append(errs, err)
+		} else {
+			delete(r.compileErrs, name)
+		}
+	}
+	for _, name := range sortedKeys(refErrs) {
+		if err := refErrs[name]; err != nil {
+			r.refErrs[name] = err
+			errs = append(errs, err)
+		} else {
+			delete(r.refErrs, name)
+		}
+	}
+	names := append(sortedKeys(changed), removed...)
+	return names, errors.Join(errs...)
+}
+
+// Err returns the problems of the templates as they are now, or nil.
+func (r *Reloader) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for _, name := range sortedKeys(r.compileErrs) {
+		errs = append(errs, r.compileErrs[name])
+	}
+	for _, name := range sortedKeys(r.refErrs) {
+		errs = append(errs, r.refErrs[name])
+	}
+	return errors.Join(errs...)
+}
+
+// Watch calls Check every interval until ctx is done, and report with the
+// result of every Check that found changes or failed.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, report func(changed []string, err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if changed, err := r.Check(); (len(changed) > 0 || err != nil) && report != nil {
+				report(changed, err)
+			}
+		}
+	}
+}
+
+func (r *Reloader) watched(p string) bool {
+	for _, ext := range r.exts {
+		if strings.HasSuffix(p, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// templateName returns the name of the template in the file at p.
+func templateName(p string) string {
+	return strings.TrimSuffix(p, path.Ext(p))
+}
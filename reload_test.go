@@ -0,0 +1,84 @@
+package mustachio
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestReloader(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"page.mustache":            {Data: []byte("[{{>partials/footer}}]"), ModTime: t0},
+		"partials/footer.mustache": {Data: []byte("bye"), ModTime: t0},
+		"notes.txt":                {Data: []byte("ignored"), ModTime: t0},
+	}
+	r, err := NewReloader(fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := func(want string) {
+		t.Helper()
+		out, err := r.Render("page", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != want {
+			t.Fatalf("got %q want %q", out, want)
+		}
+	}
+	check := func(want []string) error {
+		t.Helper()
+		changed, err := r.Check()
+		if !reflect.DeepEqual(changed, want) {
+			t.Fatalf("changed %v, want %v", changed, want)
+		}
+		return err
+	}
+	render("[bye]")
+	if err := check(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// a modified partial is picked up by the page including it
+	fsys["partials/footer.mustache"] = &fstest.MapFile{Data: []byte("ciao"), ModTime: t0.Add(time.Second)}
+	if err := check([]string{"partials/footer"}); err != nil {
+		t.Fatal(err)
+	}
+	render("[ciao]")
+
+	// a broken file keeps the last good version
+	fsys["page.mustache"] = &fstest.MapFile{Data: []byte("{{#open}}"), ModTime: t0.Add(time.Second)}
+	var perr *ParseError
+	if err := check([]string{"page"}); !errors.As(err, &perr) || perr.Name != "page" {
+		t.Fatalf("expected *ParseError for page, got %v", err)
+	}
+	render("[ciao]")
+	if r.Err() == nil {
+		t.Fatal("Err lost the problem")
+	}
+
+	// removing the partial is reported for the templates using it
+	delete(fsys, "partials/footer.mustache")
+	var missing *MissingPartialError
+	if err := check([]string{"partials/footer"}); !errors.As(err, &missing) || missing.Template != "page" {
+		t.Fatalf("expected *MissingPartialError in page, got %v", err)
+	}
+	render("[]")
+	if err := r.Err(); !errors.As(err, &perr) || !errors.As(err, &missing) {
+		t.Fatalf("expected both problems, got %v", err)
+	}
+
+	// fixing both clears the problems
+	fsys["page.mustache"] = &fstest.MapFile{Data: []byte("<{{>partials/footer}}>"), ModTime: t0.Add(2 * time.Second)}
+	fsys["partials/footer.mustache"] = &fstest.MapFile{Data: []byte("back"), ModTime: t0}
+	if err := check([]string{"page", "partials/footer"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	render("<back>")
+}
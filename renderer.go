@@ -6,9 +6,10 @@
 //   - Variables with HTML escaping: {{name}}
 //   - Unescaped variables: {{{name}}} and {{& name}}
 //   - Sections and inverted sections: {{#section}}...{{/section}}
-//   - Partials: {{> user}}
+//   - Partials: {{> user}}, and dynamic partials: {{>*name}}
 //   - Set delimiters: {{=<% %>=}}
 //   - Lambda functions (optional spec feature)
+//   - Template inheritance: {{<parent}}...{{/parent}} and {{$block}}...{{/block}}
 //   - Numeric indexing in dotted names
 //
 // Example:
@@ -16,20 +17,27 @@
 //	template := "Hello {{name}}!"
 //	data := map[string]any{"name": "World"}
 //	result, err := mustachio.Render(template, data, nil)
+//
+// Templates rendered repeatedly should be compiled once and reused:
+//
+//	tpl, err := mustachio.Compile("Hello {{name}}!")
+//	result, err := tpl.Render(data)
 package mustachio
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"html"
 	"io"
 	"reflect"
 	"strings"
 )
 
 // ValueProvider provides values for keys (including dotted names) during rendering.
-// Implementations may support lambdas by returning a func() any or func(string) any.
-// For simple use, a plain map[string]any can be wrapped via MapProvider.
+// Values are interpreted the same way whichever provider returns them, so a provider
+// may return lambdas, lists, maps or structs.
+// For simple use, a plain map[string]any can be wrapped via MapProvider; custom
+// implementations are passed to RenderProvider or (*Template).ExecuteProvider.
 
 type ValueProvider interface {
 	// Lookup returns a value for a given dotted name within the current stack of contexts.
@@ -39,11 +47,18 @@ type ValueProvider interface {
 	Push(ctx any) ValueProvider
 }
 
-// MapProvider implements ValueProvider on a stack of contexts, each being map[string]any or struct via map-like interface.
-// We keep it simple and support map[string]any and struct via reflect tags later if needed.
+// MapProvider implements ValueProvider on a stack of contexts, each being a map with string-like
+// keys, a slice or array (indexed by numeric name segments), or a struct (or pointer to struct).
+// Struct fields are found by name or by their `mustache` tag (falling back to the `json` tag),
+// including promoted fields of embedded structs, and exported zero-argument methods are called to
+// produce a value.
 
 type MapProvider struct {
 	stack []any
+	// memo caches lookups per context frame, nil unless memoizing; frames
+	// holds the identity of each context for it
+	memo   *memo
+	frames []any
 }
 
 func NewMapProvider(root any) *MapProvider {
@@ -51,12 +66,17 @@ func NewMapProvider(root any) *MapProvider {
 }
 
 func (p *MapProvider) Push(ctx any) ValueProvider {
-	cp := &MapProvider{stack: make([]any, len(p.stack)+1)}
+	cp := &MapProvider{stack: make([]any, len(p.stack)+1), memo: p.memo}
 	copy(cp.stack, p.stack)
 	cp.stack[len(p.stack)] = ctx
+	if p.memo != nil {
+		cp.frames = append(p.frames[:len(p.frames):len(p.frames)], p.memo.frameID(ctx))
+	}
 	return cp
 }
 
+func (p *MapProvider) depth() int { return len(p.stack) }
+
 func (p *MapProvider) Lookup(name string) (any, bool) {
 	// Implicit iterator
 	if name == "." {
@@ -65,38 +85,52 @@ func (p *MapProvider) Lookup(name string) (any, bool) {
 		}
 		return p.stack[len(p.stack)-1], true
 	}
-	if strings.Contains(name, ".") {
-		segments := strings.Split(name, ".")
-		first := segments[0]
-		rest := segments[1:]
-		for i := len(p.stack) - 1; i >= 0; i-- {
-			base, ok := lookupInContext(p.stack[i], []string{first})
-			if !ok {
-				continue
-			}
-			val, ok := lookupInContext(base, rest)
-			if ok {
-				return val, true
-			}
-			// If chain fails from this base, do not fall back to lower stack frames
-			return nil, false
-		}
-		return nil, false
-	}
-	// simple name
-	segments := []string{name}
+	first, rest, dotted := strings.Cut(name, ".")
 	for i := len(p.stack) - 1; i >= 0; i-- {
-		val, ok := lookupInContext(p.stack[i], segments)
-		if ok {
-			return val, true
+		base, ok := p.lookupIn(i, first, p.stack[i], first)
+		if !ok {
+			continue
+		}
+		if _, failed := base.(lazyError); failed || !dotted {
+			return base, true
 		}
+		// If chain fails from this base, do not fall back to lower stack frames
+		return p.lookupIn(i, name, base, rest)
 	}
 	return nil, false
 }
 
+// lookupIn looks up the dotted name in ctx, which is or belongs to stack frame
+// i. When memoizing, the result is cached under key, the full name relative
+// to the frame.
+func (p *MapProvider) lookupIn(i int, key string, ctx any, name string) (any, bool) {
+	segments := []string{name}
+	if strings.Contains(name, ".") {
+		segments = strings.Split(name, ".")
+	}
+	if p.memo == nil {
+		return lookupInContext(ctx, segments)
+	}
+	k := memoKey{frame: p.frames[i], name: key}
+	if v, ok := p.memo.values[k]; ok {
+		return v, true
+	}
+	v, ok := lookupInContext(ctx, segments)
+	if ok {
+		p.memo.values[k] = v
+	}
+	return v, ok
+}
+
 func lookupInContext(ctx any, segments []string) (any, bool) {
 	current := ctx
-	for _, s := range segments {
+	for i, s := range segments {
+		if i > 0 {
+			current = resolveLazy(current)
+			if _, failed := current.(lazyError); failed {
+				return current, true
+			}
+		}
 		// Try map lookup
 		if mm, ok := current.(map[string]any); ok {
 			v, exists := mm[s]
@@ -108,37 +142,58 @@ func lookupInContext(ctx any, segments []string) (any, bool) {
 		}
 		// Try slice/array numeric index
 		if arr, ok := current.([]any); ok {
-			idx := -1
-			if len(s) > 0 {
-				idx = 0
-				for _, ch := range s {
-					if ch < '0' || ch > '9' {
-						idx = -1
-						break
-					}
-					idx = idx*10 + int(ch-'0')
-				}
-			}
+			idx := parseIndex(s)
 			if idx < 0 || idx >= len(arr) {
 				return nil, false
 			}
 			current = arr[idx]
 			continue
 		}
+		// Try struct fields and methods, typed maps, slices and arrays
+		if v, ok := lookupReflect(reflect.ValueOf(current), s); ok {
+			current = v
+			continue
+		}
 		return nil, false
 	}
-	return current, true
+	return resolveLazy(current), true
 }
 
 // Node types
 
 type node interface {
-	render(w io.Writer, provider ValueProvider, partials PartialLoader, delimiters delimiters) error
+	render(w io.Writer, provider ValueProvider, st *renderState) error
 }
 
-type textNode struct{ text string }
+// renderState carries the settings and the inheritance scope of a render.
+// Nodes share it read-only; parent templates copy it to add block overrides.
+type renderState struct {
+	name     string // template or partial being rendered, for errors
+	chain    []string
+	ctx      context.Context
+	done     <-chan struct{} // ctx.Done(), nil if ctx cannot be cancelled
+	partials PartialLoaderContext
+	delims   delimiters
+	blocks   map[string]*blockNode
+	// escape is applied to {{name}} values; escapeChunks reports whether it
+	// may be applied to a value piece by piece as it is streamed
+	escape       Escaper
+	escapeChunks bool
+	// strict mode: fail on names and partials that cannot be resolved
+	strict         bool
+	strictPartials bool
+	// resource limits, nil if there are none
+	limits       *limiter
+	partialDepth int
+	sectionDepth int
+}
+
+type textNode struct {
+	text   string
+	offset int // in the template source, for errors
+}
 
-func (t *textNode) render(w io.Writer, _ ValueProvider, _ PartialLoader, _ delimiters) error {
+func (t *textNode) render(w io.Writer, _ ValueProvider, _ *renderState) error {
 	_, err := io.WriteString(w, t.text)
 	return err
 }
@@ -146,49 +201,68 @@ func (t *textNode) render(w io.Writer, _ ValueProvider, _ PartialLoader, _ delim
 type varNode struct {
 	name      string
 	unescaped bool
+	pos       Position
+	html      *htmlState // set in contextual escaping mode
 }
 
-func (v *varNode) render(w io.Writer, p ValueProvider, _ PartialLoader, _ delimiters) error {
-	val, ok := p.Lookup(v.name)
-	if !ok || val == nil {
+func (v *varNode) render(w io.Writer, p ValueProvider, st *renderState) error {
+	val, ok, err := lookup(p, v.name, v.pos, st)
+	if err != nil {
+		return err
+	}
+	if !ok && st.strict {
+		return missingKey(v.name, v.pos, p, st)
+	}
+	if !ok || val == nil || isNilPointer(val) {
 		return nil
 	}
-	// Variable lambda: if callable zero-arg returns string, render as mustache against current context
-	if str, called, err := tryCallZeroArgLambda(val); called {
+	lc := lambdaContext{name: v.name, pos: v.pos, delims: delimiters{otag: "{{", ctag: "}}"}, html: v.html, p: p, st: st}
+	if str, called, err := tryCallContextLambda(val, lc); called {
 		if err != nil {
 			return err
 		}
-		ast, err := Parse(str, delimiters{otag: "{{", ctag: "}}"})
+		if !v.unescaped {
+			str = v.escape(str, st)
+		}
+		_, err = io.WriteString(w, str)
+		return err
+	}
+	// Variable lambda: if callable zero-arg returns string, render as mustache against current context
+	if str, called, err := tryCallZeroArgLambda(val, v.name, v.pos, st); called {
 		if err != nil {
 			return err
 		}
-		var buf bytes.Buffer
-		if err := ast.render(&buf, p, nil, delimiters{otag: "{{", ctag: "}}"}); err != nil {
-			return err
+		ast, err := Parse(str, delimiters{otag: "{{", ctag: "}}"})
+		if err != nil {
+			return &LambdaError{Template: st.name, Name: v.name, Position: v.pos, Err: err}
 		}
-		out := buf.String()
 		if v.unescaped {
-			_, err := io.WriteString(w, out)
+			return ast.render(w, p, st)
+		}
+		if st.escapeChunks && v.html == nil {
+			return ast.render(escapeWriter{w: w, escape: st.escape}, p, st)
+		}
+		out, err := renderBuffered(ast, p, st)
+		if err != nil {
 			return err
 		}
-		_, err = io.WriteString(w, escapeHTMLSpec(out))
+		_, err = io.WriteString(w, v.escape(out, st))
 		return err
 	}
-	s := toString(val)
 	if v.unescaped {
-		_, err := io.WriteString(w, s)
+		_, err := io.WriteString(w, toString(val))
 		return err
 	}
-	_, err := io.WriteString(w, escapeHTMLSpec(s))
+	_, err = io.WriteString(w, v.escape(val, st))
 	return err
 }
 
-func escapeHTMLSpec(s string) string {
-	// Spec expects &quot; for double quotes; Go's html.EscapeString outputs &#34;
-	// We can use html.EscapeString then replace numeric entity with &quot;
-	esc := html.EscapeString(s)
-	esc = strings.ReplaceAll(esc, "&#34;", "&quot;")
-	return esc
+// escape escapes val for the context of the tag.
+func (v *varNode) escape(val any, st *renderState) string {
+	if v.html != nil {
+		return v.html.escape(val)
+	}
+	return st.escape(toString(val))
 }
 
 type sectionNode struct {
@@ -196,6 +270,9 @@ type sectionNode struct {
 	inverted bool
 	children []node
 	raw      string
+	delims   delimiters // in effect at the tag, for lambdas
+	pos      Position
+	html     *htmlState
 }
 
 func isFalsey(value any) bool {
@@ -208,8 +285,13 @@ func isFalsey(value any) bool {
 		return v == ""
 	case []any:
 		return len(v) == 0
+	case []byte:
+		return len(v) == 0
+	}
+	if rv, ok := asList(value); ok {
+		return rv.Len() == 0
 	}
-	return false
+	return isNilPointer(value)
 }
 
 func toString(v any) string {
@@ -227,20 +309,26 @@ func toString(v any) string {
 	}
 }
 
-func (s *sectionNode) render(w io.Writer, p ValueProvider, partials PartialLoader, delims delimiters) error {
-	val, _ := p.Lookup(s.name)
+func (s *sectionNode) render(w io.Writer, p ValueProvider, st *renderState) error {
+	val, ok, err := lookup(p, s.name, s.pos, st)
+	if err != nil {
+		return err
+	}
+	if !ok && st.strict {
+		return missingKey(s.name, s.pos, p, st)
+	}
+	st, err = st.enterSection(s.pos)
+	if err != nil {
+		return err
+	}
 	if s.inverted {
 		if isFalsey(val) {
-			return renderChildren(w, p, partials, delims, s.children)
+			return renderChildren(w, p, st, s.children)
 		}
 		return nil
 	}
 	// Section lambda
-	if rendered, called, err := tryCallSectionLambda(val, s.raw, p, partials, delims); called {
-		if err != nil {
-			return err
-		}
-		_, err := io.WriteString(w, rendered)
+	if called, err := tryCallSectionLambda(w, val, s, p, st); called {
 		return err
 	}
 	// normal section
@@ -249,45 +337,140 @@ func (s *sectionNode) render(w io.Writer, p ValueProvider, partials PartialLoade
 		return nil
 	case bool:
 		if v {
-			return renderChildren(w, p, partials, delims, s.children)
+			return renderChildren(w, p, st, s.children)
 		}
 		return nil
 	case []any:
 		for _, item := range v {
-			if err := renderChildren(w, p.Push(item), partials, delims, s.children); err != nil {
+			if err := st.iterate(s.pos); err != nil {
+				return err
+			}
+			if err := renderChildren(w, p.Push(item), st, s.children); err != nil {
 				return err
 			}
 		}
 		return nil
 	case map[string]any:
-		return renderChildren(w, p.Push(v), partials, delims, s.children)
+		return renderChildren(w, p.Push(v), st, s.children)
 	default:
+		if isFalsey(v) {
+			return nil
+		}
+		if rv, ok := asList(v); ok {
+			for i := 0; i < rv.Len(); i++ {
+				if err := st.iterate(s.pos); err != nil {
+					return err
+				}
+				if err := renderChildren(w, p.Push(rv.Index(i).Interface()), st, s.children); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
 		// truthy
-		return renderChildren(w, p.Push(v), partials, delims, s.children)
+		return renderChildren(w, p.Push(v), st, s.children)
 	}
 }
 
 type partialNode struct {
-	name   string
-	indent string
+	name    string
+	dynamic bool // {{>*name}}: name is looked up in the context
+	indent  string
+	pos     Position
+	html    *htmlState
 }
 
-func (pn *partialNode) render(w io.Writer, p ValueProvider, partials PartialLoader, delims delimiters) error {
-	if partials == nil {
-		return nil
-	}
-	tpl, ok := partials.LoadPartial(pn.name)
-	if !ok || tpl == "" {
-		return nil
-	}
-	if pn.indent != "" {
-		tpl = applyIndent(tpl, pn.indent)
+func (pn *partialNode) render(w io.Writer, p ValueProvider, st *renderState) error {
+	ast, name, err := loadPartial(pn.name, pn.dynamic, pn.indent, pn.pos, pn.html, p, st)
+	if ast == nil || err != nil {
+		return err
 	}
-	ast, err := Parse(tpl, delims)
+	inner, err := st.enter(name, pn.pos)
 	if err != nil {
 		return err
 	}
-	return ast.render(w, p, partials, delims)
+	return ast.render(w, p, inner)
+}
+
+// enter returns the state for rendering the partial or parent called name,
+// included by the tag at pos.
+func (st *renderState) enter(name string, pos Position) (*renderState, error) {
+	max := DefaultMaxPartialDepth
+	if st.limits != nil && st.limits.MaxPartialDepth != 0 {
+		max = st.limits.MaxPartialDepth
+	}
+	if max > 0 && st.partialDepth >= max {
+		return nil, st.limitError(pos, int64(max), ErrMaxPartialDepth)
+	}
+	inner := *st
+	inner.name = name
+	inner.chain = append(st.chain[:len(st.chain):len(st.chain)], name)
+	inner.partialDepth++
+	return &inner, nil
+}
+
+// loadPartial loads and parses the partial called name, or, if dynamic is set,
+// the partial whose name is the value of name in the current context. It
+// returns the AST and the resolved name, or a nil AST if there is no such
+// partial. In contextual escaping mode, html is the HTML state at the tag.
+func loadPartial(name string, dynamic bool, indent string, pos Position, html *htmlState, p ValueProvider, st *renderState) (*rootNode, string, error) {
+	if dynamic {
+		val, ok, err := lookup(p, name, pos, st)
+		if err != nil {
+			return nil, "", err
+		}
+		if !ok && st.strict {
+			return nil, "", missingKey(name, pos, p, st)
+		}
+		if !ok || val == nil {
+			return nil, "", nil
+		}
+		name = toString(val)
+	}
+	parse := func(tpl string) (*rootNode, error) {
+		if indent == "" {
+			return parseIn(tpl, st.delims, html)
+		}
+		ast, err := parseIn(applyIndent(tpl, indent), st.delims, html)
+		var perr *ParseError
+		if errors.As(err, &perr) {
+			perr.unindent(tpl, len(indent))
+		}
+		return ast, err
+	}
+	var ast *rootNode
+	var err error
+	switch loader := st.partials.(type) {
+	case nil:
+		err = ErrPartialNotFound
+	case parsedPartials:
+		key := partialKey{name: name, indent: indent, delims: st.delims}
+		if html != nil {
+			key.contextual, key.html = true, *html
+		}
+		ast, err = loader.loadParsed(st.ctx, key, parse)
+	default:
+		var tpl string
+		if tpl, err = loader.LoadPartial(st.ctx, name); err == nil {
+			ast, err = parse(tpl)
+		}
+	}
+	var perr *ParseError
+	switch {
+	case err == nil:
+		return ast, name, nil
+	case errors.Is(err, ErrPartialNotFound):
+		if st.strictPartials {
+			return nil, "", &MissingPartialError{Template: st.name, Name: name, Position: pos}
+		}
+		return nil, "", nil
+	case errors.As(err, &perr):
+		if perr.Name == "" {
+			perr.Name = name
+		}
+		return nil, "", err
+	}
+	return nil, "", &PartialError{Name: name, Chain: st.chain, Position: pos, Err: err}
 }
 
 func applyIndent(tpl string, indent string) string {
@@ -313,13 +496,16 @@ func applyIndent(tpl string, indent string) string {
 
 type rootNode struct{ children []node }
 
-func (r *rootNode) render(w io.Writer, p ValueProvider, partials PartialLoader, delims delimiters) error {
-	return renderChildren(w, p, partials, delims, r.children)
+func (r *rootNode) render(w io.Writer, p ValueProvider, st *renderState) error {
+	return renderChildren(w, p, st, r.children)
 }
 
-func renderChildren(w io.Writer, p ValueProvider, partials PartialLoader, delims delimiters, nodes []node) error {
+func renderChildren(w io.Writer, p ValueProvider, st *renderState, nodes []node) error {
 	for _, n := range nodes {
-		if err := n.render(w, p, partials, delims); err != nil {
+		if err := st.check(); err != nil {
+			return err
+		}
+		if err := n.render(w, p, st); err != nil {
 			return err
 		}
 	}
@@ -336,6 +522,46 @@ type MapPartials map[string]string
 
 func (m MapPartials) LoadPartial(name string) (string, bool) { v, ok := m[name]; return v, ok }
 
+// PartialLoaderContext loads partial templates by name and can report why a
+// partial could not be loaded. It returns an error wrapping
+// ErrPartialNotFound if there is no such partial; that renders nothing (or
+// fails with a *MissingPartialError in strict mode) as for a PartialLoader.
+// Any other error aborts the render with a *PartialError.
+
+type PartialLoaderContext interface {
+	LoadPartial(ctx context.Context, name string) (string, error)
+}
+
+// ErrPartialNotFound is returned by a PartialLoaderContext for an unknown
+// partial.
+var ErrPartialNotFound = errors.New("partial not found")
+
+// AdaptPartialLoader turns a PartialLoader into a PartialLoaderContext.
+
+func AdaptPartialLoader(l PartialLoader) PartialLoaderContext {
+	return adaptedLoader{l}
+}
+
+type adaptedLoader struct{ l PartialLoader }
+
+func (a adaptedLoader) LoadPartial(_ context.Context, name string) (string, error) {
+	if src, ok := a.l.LoadPartial(name); ok {
+		return src, nil
+	}
+	return "", ErrPartialNotFound
+}
+
+func (a adaptedLoader) loadParsed(ctx context.Context, key partialKey, parse func(string) (*rootNode, error)) (*rootNode, error) {
+	if pp, ok := a.l.(parsedPartials); ok {
+		return pp.loadParsed(ctx, key, parse)
+	}
+	src, err := a.LoadPartial(ctx, key.name)
+	if err != nil {
+		return nil, err
+	}
+	return parse(src)
+}
+
 // delimiters represents the current opening and closing tag delimiters
 
 type delimiters struct {
@@ -353,22 +579,60 @@ func Parse(template string, delims delimiters) (*rootNode, error) {
 	if err != nil {
 		return nil, err
 	}
-	return parseTokens(template, tokens)
+	return parseTokens(template, tokens, delims)
+}
+
+// parseIn parses a template that is rendered at a point whose HTML state is
+// html, which is nil unless contextual escaping is enabled. In contextual
+// mode, the template must end in the state it starts in, as the text after
+// it is escaped for that state.
+func parseIn(template string, delims delimiters, html *htmlState) (*rootNode, error) {
+	ast, err := Parse(template, delims)
+	if err != nil || html == nil {
+		return ast, err
+	}
+	end, err := contextualize(template, ast.children, *html)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := sameState(*html, end); !ok {
+		return nil, newParseError(template, len(template), len(template),
+			fmt.Sprintf("template starts in HTML %s but ends in HTML %s", *html, end))
+	}
+	return ast, nil
 }
 
 // Render renders a template with the provided data context and partials.
+// Use Compile instead when the same template is rendered more than once.
 
 func Render(template string, data any, partials PartialLoader) (string, error) {
-	ast, err := Parse(template, delimiters{otag: "{{", ctag: "}}"})
+	t, err := Compile(template, WithPartials(partials))
 	if err != nil {
 		return "", err
 	}
-	var buf bytes.Buffer
-	prov := NewMapProvider(toAnyMap(data))
-	if err := ast.render(&buf, prov, partials, delimiters{otag: "{{", ctag: "}}"}); err != nil {
+	return t.Render(data)
+}
+
+// Execute renders a template with the provided data context and partials and
+// writes the output directly to w as it is produced.
+
+func Execute(w io.Writer, template string, data any, partials PartialLoader) error {
+	t, err := Compile(template, WithPartials(partials))
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, data)
+}
+
+// RenderProvider renders a template against a custom ValueProvider instead of
+// wrapping data in a MapProvider.
+
+func RenderProvider(template string, p ValueProvider, partials PartialLoader) (string, error) {
+	t, err := Compile(template, WithPartials(partials))
+	if err != nil {
 		return "", err
 	}
-	return buf.String(), nil
+	return t.RenderProvider(p)
 }
 
 func toAnyMap(d any) any {
@@ -394,6 +658,8 @@ const (
 	tPartial
 	tComment
 	tSetDelims
+	tParentStart
+	tBlockStart
 )
 
 type token struct {
@@ -425,7 +691,7 @@ func lex(input string, delims delimiters) ([]token, error) {
 		if otag == "{{" && strings.HasPrefix(input[i:], "{{{") {
 			end := strings.Index(input[i+3:], "}}}")
 			if end < 0 {
-				return nil, fmt.Errorf("unclosed triple mustache")
+				return nil, newParseError(input, i, lineEnd(input, i), "unclosed triple mustache")
 			}
 			end += i + 3
 			name := strings.TrimSpace(input[i+3 : end])
@@ -435,7 +701,7 @@ func lex(input string, delims delimiters) ([]token, error) {
 		}
 		end := strings.Index(input[i+len(otag):], ctag)
 		if end < 0 {
-			return nil, fmt.Errorf("unclosed tag")
+			return nil, newParseError(input, i, lineEnd(input, i), "unclosed tag")
 		}
 		end += i + len(otag)
 		tagContent := strings.TrimSpace(input[i+len(otag) : end])
@@ -453,7 +719,7 @@ func lex(input string, delims delimiters) ([]token, error) {
 			inner := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(tagContent, "="), "="))
 			parts := strings.Fields(inner)
 			if len(parts) != 2 {
-				return nil, fmt.Errorf("invalid set delimiters")
+				return nil, newParseError(input, i, tagEnd, "invalid set delimiters")
 			}
 			tokens = append(tokens, token{typ: tSetDelims, val: parts[0] + " " + parts[1], start: i, end: tagEnd})
 			// update runtime delimiters for subsequent lexing
@@ -465,6 +731,10 @@ func lex(input string, delims delimiters) ([]token, error) {
 			tokens = append(tokens, token{typ: tInvertedStart, val: strings.TrimSpace(tagContent[1:]), start: i, end: tagEnd})
 		case strings.HasPrefix(tagContent, "/"):
 			tokens = append(tokens, token{typ: tSectionEnd, val: strings.TrimSpace(tagContent[1:]), start: i, end: tagEnd})
+		case strings.HasPrefix(tagContent, "<"):
+			tokens = append(tokens, token{typ: tParentStart, val: strings.TrimSpace(tagContent[1:]), start: i, end: tagEnd})
+		case strings.HasPrefix(tagContent, "$"):
+			tokens = append(tokens, token{typ: tBlockStart, val: strings.TrimSpace(tagContent[1:]), start: i, end: tagEnd})
 		case strings.HasPrefix(tagContent, ">"):
 			tokens = append(tokens, token{typ: tPartial, val: strings.TrimSpace(tagContent[1:]), start: i, end: tagEnd})
 		case strings.HasPrefix(tagContent, "{") && strings.HasSuffix(tagContent, "}"):
@@ -481,41 +751,100 @@ func lex(input string, delims delimiters) ([]token, error) {
 	return tokens, nil
 }
 
+// lineEnd returns the offset of the end of the line containing offset i.
+func lineEnd(s string, i int) int {
+	if n := strings.IndexByte(s[i:], '\n'); n >= 0 {
+		return i + n
+	}
+	return len(s)
+}
+
 // standalone utilities
 
-func isWhitespaceOnly(s string) bool {
-	for i := 0; i < len(s); i++ {
-		if s[i] != ' ' && s[i] != '\t' && s[i] != '\r' {
-			return false
+// dynamicName splits the `*` marker of the dynamic names module off a partial
+// or parent tag name: `{{> *name}}` refers to the partial named by the value
+// of name.
+func dynamicName(tagName string) (name string, dynamic bool) {
+	if strings.HasPrefix(tagName, "*") {
+		return strings.TrimSpace(tagName[1:]), true
+	}
+	return tagName, false
+}
+
+// lineSharers marks the tokens that may share a standalone line with other
+// tags: parent and block tags and the tags closing them, as the inheritance
+// spec requires for lines like `  {{<parent}}{{/parent}}`. Other standalone
+// tags must be alone on their line.
+func lineSharers(tokens []token) []bool {
+	sharers := make([]bool, len(tokens))
+	var open []bool // whether each open section is a parent or block
+	for i, t := range tokens {
+		switch t.typ {
+		case tSectionStart, tInvertedStart:
+			open = append(open, false)
+		case tParentStart, tBlockStart:
+			open = append(open, true)
+			sharers[i] = true
+		case tSectionEnd:
+			if len(open) > 0 {
+				sharers[i] = open[len(open)-1]
+				open = open[:len(open)-1]
+			}
 		}
 	}
-	return true
+	return sharers
 }
 
-func detectStandalone(template string, t token) (standalone bool, indent string, removeTo int) {
-	// find start of line
-	ls := t.start
-	for ls > 0 {
-		if template[ls-1] == '\n' {
-			break
+// detectStandalone reports whether tokens[i] sits on a standalone line: a line
+// holding nothing but whitespace and the tag, or whitespace and several tags
+// marked in sharers. indent is the leading whitespace of the line and
+// removeTo the offset just past its end, including the newline.
+func detectStandalone(template string, tokens []token, sharers []bool, i int) (standalone bool, indent string, removeTo int) {
+	isSpace := func(c byte) bool { return c == ' ' || c == '\t' || c == '\r' }
+	shared := false
+	// walk back to the start of the line over whitespace and other tags
+	ls := tokens[i].start
+	for j := i - 1; ; {
+		for ls > 0 && isSpace(template[ls-1]) {
+			ls--
 		}
-		ls--
+		if j >= 0 && tokens[j].end == ls && sharers[j] {
+			ls = tokens[j].start
+			shared = true
+			j--
+			continue
+		}
+		break
 	}
-	indent = template[ls:t.start]
-	if !isWhitespaceOnly(indent) {
+	if ls > 0 && template[ls-1] != '\n' {
 		return false, "", 0
 	}
-	// find end of line
-	le := t.end
-	for le < len(template) && template[le] != '\n' {
-		le++
+	// walk forward to the end of the line the same way
+	le := tokens[i].end
+	for j := i + 1; ; {
+		for le < len(template) && isSpace(template[le]) {
+			le++
+		}
+		if j < len(tokens) && tokens[j].start == le && sharers[j] {
+			le = tokens[j].end
+			shared = true
+			j++
+			continue
+		}
+		break
 	}
-	trail := template[t.end:le]
-	if !isWhitespaceOnly(trail) {
+	if le < len(template) && template[le] != '\n' || shared && !sharers[i] {
 		return false, "", 0
 	}
+	indent = template[ls:]
+	for k := 0; k < len(indent); k++ {
+		if !isSpace(indent[k]) {
+			indent = indent[:k]
+			break
+		}
+	}
 	// remove through newline if present
-	if le < len(template) && template[le] == '\n' {
+	if le < len(template) {
 		removeTo = le + 1
 	} else {
 		removeTo = le
@@ -523,28 +852,44 @@ func detectStandalone(template string, t token) (standalone bool, indent string,
 	return true, indent, removeTo
 }
 
-func parseTokens(template string, tokens []token) (*rootNode, error) {
+func parseTokens(template string, tokens []token, delims delimiters) (*rootNode, error) {
 	root := &rootNode{}
-	type openSec struct {
-		node  *sectionNode
-		start int
+	sharers := lineSharers(tokens)
+	// positions are computed incrementally as tokens come in source order
+	line, lineStart, scanned := 1, 0, 0
+	posOf := func(offset int) Position {
+		for ; scanned < offset; scanned++ {
+			if template[scanned] == '\n' {
+				line++
+				lineStart = scanned + 1
+			}
+		}
+		return Position{Offset: offset, Line: line, Column: offset - lineStart + 1}
 	}
-	stack := []openSec{}
-	appendNode := func(n node) {
+	// openTag is a section, parent or block tag waiting for its closing tag.
+	type openTag struct {
+		node     node
+		name     string
+		tag      token
+		start    int // offset just after the opening tag
+		removeTo int // offset after the opening tag's line if it is standalone, else -1
+		delims   delimiters
+		children []node
+	}
+	stack := []*openTag{}
+	children := func() *[]node {
 		if len(stack) == 0 {
-			root.children = append(root.children, n)
-		} else {
-			stack[len(stack)-1].node.children = append(stack[len(stack)-1].node.children, n)
+			return &root.children
 		}
+		return &stack[len(stack)-1].children
+	}
+	appendNode := func(n node) {
+		list := children()
+		*list = append(*list, n)
 	}
 	// helper to truncate last text node to before line start
-	truncateIndent := func(indentStart int) {
-		var list *[]node
-		if len(stack) == 0 {
-			list = &root.children
-		} else {
-			list = &stack[len(stack)-1].node.children
-		}
+	truncateIndent := func() {
+		list := children()
 		if len(*list) == 0 {
 			return
 		}
@@ -570,23 +915,29 @@ func parseTokens(template string, tokens []token) (*rootNode, error) {
 					t.start = skipUntil
 				}
 			}
-			appendNode(&textNode{text: t.val})
+			appendNode(&textNode{text: t.val, offset: t.start})
 			continue
 		}
 		switch t.typ {
 		case tVar:
-			appendNode(&varNode{name: t.val, unescaped: false})
+			appendNode(&varNode{name: t.val, unescaped: false, pos: posOf(t.start)})
 		case tUVar:
-			appendNode(&varNode{name: t.val, unescaped: true})
-		case tPartial, tComment, tSetDelims, tSectionStart, tInvertedStart, tSectionEnd:
-			standalone, indent, removeTo := detectStandalone(template, t)
+			appendNode(&varNode{name: t.val, unescaped: true, pos: posOf(t.start)})
+		default:
+			standalone, indent, removeTo := detectStandalone(template, tokens, sharers, i)
 			if standalone {
-				truncateIndent(t.start)
+				truncateIndent()
 				skipUntil = removeTo
+			} else {
+				removeTo = -1
+			}
+			open := func(n node) {
+				stack = append(stack, &openTag{node: n, name: t.val, tag: t, start: t.end, removeTo: removeTo, delims: delims})
 			}
 			switch t.typ {
 			case tPartial:
-				pn := &partialNode{name: t.val}
+				name, dynamic := dynamicName(t.val)
+				pn := &partialNode{name: name, dynamic: dynamic, pos: posOf(t.start)}
 				if standalone {
 					pn.indent = indent
 				}
@@ -594,76 +945,86 @@ func parseTokens(template string, tokens []token) (*rootNode, error) {
 			case tComment:
 				// no AST node
 			case tSetDelims:
-				// ignore; delimiters already applied during lex
+				// delimiters were already applied during lex; track them for blocks
+				parts := strings.Fields(t.val)
+				delims = delimiters{otag: parts[0], ctag: parts[1]}
 			case tSectionStart:
-				stack = append(stack, openSec{node: &sectionNode{name: t.val}, start: t.end})
+				open(&sectionNode{name: t.val, pos: posOf(t.start)})
 			case tInvertedStart:
-				stack = append(stack, openSec{node: &sectionNode{name: t.val, inverted: true}, start: t.end})
+				open(&sectionNode{name: t.val, inverted: true, pos: posOf(t.start)})
+			case tParentStart:
+				name, dynamic := dynamicName(t.val)
+				if dynamic {
+					t.val = "*" + name
+				}
+				pn := &parentNode{name: name, dynamic: dynamic, pos: posOf(t.start)}
+				if standalone {
+					pn.indent = indent
+				}
+				open(pn)
+			case tBlockStart:
+				bn := &blockNode{name: t.val, pos: posOf(t.start)}
+				if standalone {
+					bn.standalone = true
+					bn.indent = indent
+				}
+				open(bn)
 			case tSectionEnd:
 				if len(stack) == 0 {
-					return nil, fmt.Errorf("unmatched section end for %s", t.val)
+					return nil, newParseError(template, t.start, t.end, fmt.Sprintf("unmatched section end for %s", t.val))
 				}
 				sec := stack[len(stack)-1]
-				if sec.node.name != t.val {
-					return nil, fmt.Errorf("section mismatch: %s vs %s", sec.node.name, t.val)
+				closeName := t.val
+				if pn, ok := sec.node.(*parentNode); ok && pn.dynamic {
+					// a dynamic parent may be closed as {{/*name}} or {{/name}}
+					name, _ := dynamicName(t.val)
+					closeName = "*" + name
+				}
+				if sec.name != closeName {
+					err := newParseError(template, t.start, t.end, fmt.Sprintf("section mismatch: %s vs %s", sec.name, t.val))
+					open := positionAt(template, sec.tag.start)
+					err.Open = &open
+					return nil, err
 				}
-				sec.node.raw = template[sec.start:t.start]
 				stack = stack[:len(stack)-1]
+				switch n := sec.node.(type) {
+				case *sectionNode:
+					n.children = sec.children
+					n.raw = template[sec.start:t.start]
+					n.delims = sec.delims
+				case *parentNode:
+					n.blocks = map[string]*blockNode{}
+					for _, c := range sec.children {
+						if b, ok := c.(*blockNode); ok {
+							if _, dup := n.blocks[b.name]; !dup {
+								n.blocks[b.name] = b
+							}
+						}
+					}
+				case *blockNode:
+					n.children = sec.children
+					n.delims = sec.delims
+					start, end := sec.start, t.start
+					if n.standalone {
+						start = sec.removeTo
+					}
+					if standalone {
+						end = strings.LastIndexByte(template[:t.start], '\n') + 1
+					}
+					if start <= end {
+						n.raw = template[start:end]
+					}
+					if n.standalone && n.raw != "" {
+						n.indent = leadingWhitespace(n.raw)
+					}
+				}
 				appendNode(sec.node)
 			}
 		}
 	}
 	if len(stack) != 0 {
-		return nil, fmt.Errorf("unclosed section %s", stack[len(stack)-1].node.name)
+		sec := stack[len(stack)-1]
+		return nil, newParseError(template, sec.tag.start, sec.tag.end, fmt.Sprintf("unclosed section %s", sec.name))
 	}
 	return root, nil
 }
-
-// Lambda helpers
-
-func tryCallZeroArgLambda(v any) (string, bool, error) {
-	rv := reflect.ValueOf(v)
-	if rv.IsValid() && rv.Kind() == reflect.Func && rv.Type().NumIn() == 0 && rv.Type().NumOut() == 1 && rv.Type().Out(0).Kind() == reflect.String {
-		res := rv.Call(nil)
-		return res[0].String(), true, nil
-	}
-	return "", false, nil
-}
-
-func tryCallSectionLambda(v any, raw string, p ValueProvider, partials PartialLoader, delims delimiters) (string, bool, error) {
-	rv := reflect.ValueOf(v)
-	if !rv.IsValid() || rv.Kind() != reflect.Func {
-		return "", false, nil
-	}
-	// func(string) string
-	if rv.Type().NumIn() == 1 && rv.Type().In(0).Kind() == reflect.String && rv.Type().NumOut() == 1 && rv.Type().Out(0).Kind() == reflect.String {
-		res := rv.Call([]reflect.Value{reflect.ValueOf(raw)})
-		str := res[0].String()
-		ast, err := Parse(str, delims)
-		if err != nil {
-			return "", true, err
-		}
-		var buf bytes.Buffer
-		if err := ast.render(&buf, p, partials, delims); err != nil {
-			return "", true, err
-		}
-		return buf.String(), true, nil
-	}
-	// func(string, func(string) string) string
-	if rv.Type().NumIn() == 2 && rv.Type().In(0).Kind() == reflect.String && rv.Type().In(1).Kind() == reflect.Func && rv.Type().NumOut() == 1 && rv.Type().Out(0).Kind() == reflect.String {
-		renderFn := func(s string) string {
-			ast, err := Parse(s, delims)
-			if err != nil {
-				return ""
-			}
-			var buf bytes.Buffer
-			if err := ast.render(&buf, p, partials, delims); err != nil {
-				return ""
-			}
-			return buf.String()
-		}
-		res := rv.Call([]reflect.Value{reflect.ValueOf(raw), reflect.ValueOf(renderFn)})
-		return res[0].String(), true, nil
-	}
-	return "", false, nil
-}
@@ -0,0 +1,292 @@
+package mustachio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrTemplateNotFound is returned when a Set has no template of the requested
+// name.
+var ErrTemplateNotFound = errors.New("template not found")
+
+// Set is a collection of named templates that can be rendered by name and
+// include each other as partials and parents. Loading templates checks that
+// every {{> name}} and {{< name}} they use (other than dynamic names)
+// resolves, so add partials before the templates using them, or add them
+// together with AddMap or ParseFS.
+//
+// A Set is safe for concurrent use. Templates may be added while others are
+// being rendered; a render sees each partial as it was when it was included.
+type Set struct {
+	opts     []Option
+	fallback PartialLoaderContext // partials given in opts, for names not in the set
+
+	mu        sync.RWMutex
+	sources   map[string]string
+	templates map[string]*Template
+	cache     astCache
+}
+
+// NewSet returns an empty Set whose templates are compiled with opts. A
+// partial loader given in opts is used for partials that are not in the set.
+func NewSet(opts ...Option) *Set {
+	var base Template
+	for _, opt := range opts {
+		opt(&base)
+	}
+	return &Set{
+		opts:      opts,
+		fallback:  base.partials,
+		sources:   make(map[string]string),
+		templates: make(map[string]*Template),
+	}
+}
+
+// Add compiles src as the template called name, replacing any template of
+// that name. Nothing is added if src does not compile or uses a partial that
+// cannot be resolved.
+func (s *Set) Add(name, src string) error {
+	return s.AddMap(map[string]string{name: src})
+}
+
+// AddMap adds the templates in m, keyed by name, as one batch: they may
+// refer to each other, and none is added if any fails.
+func (s *Set) AddMap(m map[string]string) error {
+	compiled := make(map[string]*Template, len(m))
+	var errs []error
+	for _, name := range sortedKeys(m) {
+		t, err := s.compile(name, m[name])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		compiled[name] = t
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range sortedKeys(compiled) {
+		errs = append(errs, s.checkRefs(compiled[name], m)...)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	names := make([]string, 0, len(m))
+	for name, src := range m {
+		s.sources[name] = src
+		s.templates[name] = compiled[name]
+		names = append(names, name)
+	}
+	s.cache.invalidate(names...)
+	return nil
+}
+
+// ParseFS adds the files of fsys matching any of the glob patterns (see
+// fs.Glob) as one batch. Each template is named after its path without
+// extension, so emails/footer.mustache is {{> emails/footer}}.
+func (s *Set) ParseFS(fsys fs.FS, patterns ...string) error {
+	m := make(map[string]string)
+	for _, pattern := range patterns {
+		paths, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			b, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return err
+			}
+			m[templateName(p)] = string(b)
+		}
+	}
+	return s.AddMap(m)
+}
+
+// update adds, replaces and removes templates one by one, keeping the current
+// version of a template that fails to compile. It returns the compile errors
+// by template name, and the references that do not resolve in the templates
+// that were compiled or that use a template added or removed; templates that
+// were checked and are fine map to nil in refErrs.
+func (s *Set) update(changed map[string]string, removed []string) (compileErrs, refErrs map[string]error) {
+	compileErrs = make(map[string]error)
+	refErrs = make(map[string]error)
+	compiled := make(map[string]*Template, len(changed))
+	for name, src := range changed {
+		t, err := s.compile(name, src)
+		if err != nil {
+			compileErrs[name] = err
+			continue
+		}
+		compiled[name] = t
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// templates that come or go affect those that include them
+	addedOrRemoved := make(map[string]bool)
+	for name, t := range compiled {
+		if _, ok := s.templates[name]; !ok {
+			addedOrRemoved[name] = true
+		}
+		s.sources[name] = changed[name]
+		s.templates[name] = t
+	}
+	for _, name := range removed {
+		if _, ok := s.templates[name]; ok {
+			addedOrRemoved[name] = true
+		}
+		delete(s.sources, name)
+		delete(s.templates, name)
+	}
+	s.cache.invalidate(append(sortedKeys(compiled), removed...)...)
+
+	for _, name := range sortedKeys(s.templates) {
+		t := s.templates[name]
+		check := compiled[name] != nil
+		for _, ref := range partialRefs(t.root.children, nil) {
+			check = check || addedOrRemoved[ref.name]
+		}
+		if check {
+			refErrs[name] = errors.Join(s.checkRefs(t, nil)...)
+		}
+	}
+	return compileErrs, refErrs
+}
+
+// Lookup returns the template called name, or nil if there is none.
+func (s *Set) Lookup(name string) *Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.templates[name]
+}
+
+// Names returns the names of the templates in the set, sorted.
+func (s *Set) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sortedKeys(s.templates)
+}
+
+// Render renders the template called name with data.
+func (s *Set) Render(name string, data any) (string, error) {
+	var b strings.Builder
+	if err := s.Execute(&b, name, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Execute renders the template called name with data to w.
+func (s *Set) Execute(w io.Writer, name string, data any) error {
+	return s.ExecuteContext(context.Background(), w, name, data)
+}
+
+// ExecuteContext renders the template called name with data to w, stopping
+// once ctx is done.
+func (s *Set) ExecuteContext(ctx context.Context, w io.Writer, name string, data any) error {
+	t := s.Lookup(name)
+	if t == nil {
+		return fmt.Errorf("%q: %w", name, ErrTemplateNotFound)
+	}
+	return t.ExecuteContext(ctx, w, data)
+}
+
+// LoadPartial implements PartialLoaderContext, so the templates of the set
+// can also be used as partials elsewhere.
+func (s *Set) LoadPartial(ctx context.Context, name string) (string, error) {
+	s.mu.RLock()
+	src, ok := s.sources[name]
+	s.mu.RUnlock()
+	if ok {
+		return src, nil
+	}
+	if s.fallback != nil {
+		return s.fallback.LoadPartial(ctx, name)
+	}
+	return "", ErrPartialNotFound
+}
+
+func (s *Set) loadParsed(ctx context.Context, key partialKey, parse func(string) (*rootNode, error)) (*rootNode, error) {
+	return s.cache.get(ctx, key, partialLoaderFunc(s.LoadPartial), parse)
+}
+
+func (s *Set) compile(name, src string) (*Template, error) {
+	opts := append(s.opts[:len(s.opts):len(s.opts)], WithName(name), WithPartialsContext(s))
+	return Compile(src, opts...)
+}
+
+// checkRefs reports the partials and parents used by t that are neither in
+// the set nor in batch. s.mu must be held.
+func (s *Set) checkRefs(t *Template, batch map[string]string) []error {
+	var errs []error
+	for _, ref := range partialRefs(t.root.children, nil) {
+		if _, ok := batch[ref.name]; ok {
+			continue
+		}
+		if _, ok := s.sources[ref.name]; ok {
+			continue
+		}
+		if s.fallback != nil {
+			if _, err := s.fallback.LoadPartial(context.Background(), ref.name); err == nil {
+				continue
+			}
+		}
+		errs = append(errs, &MissingPartialError{Template: t.name, Name: ref.name, Position: ref.pos})
+	}
+	return errs
+}
+
+type partialRef struct {
+	name string
+	pos  Position
+}
+
+// partialRefs appends the partials and parents used in nodes to refs,
+// except dynamic ones.
+func partialRefs(nodes []node, refs []partialRef) []partialRef {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *partialNode:
+			if !n.dynamic {
+				refs = append(refs, partialRef{n.name, n.pos})
+			}
+		case *parentNode:
+			if !n.dynamic {
+				refs = append(refs, partialRef{n.name, n.pos})
+			}
+			for _, name := range sortedKeys(n.blocks) {
+				refs = partialRefs(n.blocks[name].children, refs)
+			}
+		case *sectionNode:
+			refs = partialRefs(n.children, refs)
+		case *blockNode:
+			refs = partialRefs(n.children, refs)
+		}
+	}
+	return refs
+}
+
+// partialLoaderFunc adapts a func to PartialLoaderContext.
+type partialLoaderFunc func(ctx context.Context, name string) (string, error)
+
+func (f partialLoaderFunc) LoadPartial(ctx context.Context, name string) (string, error) {
+	return f(ctx, name)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
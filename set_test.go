@@ -0,0 +1,106 @@
+package mustachio
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSet(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layout.mustache":        {Data: []byte("<title>{{$title}}Site{{/title}}</title>{{$body}}{{/body}}")},
+		"page.mustache":          {Data: []byte("{{<layout}}{{$title}}{{name}}{{/title}}{{$body}}{{>emails/footer}}{{/body}}{{/layout}}")},
+		"emails/footer.mustache": {Data: []byte("Bye {{name}}")},
+		"README.md":              {Data: []byte("not a template")},
+	}
+	set := NewSet()
+	if err := set.ParseFS(fsys, "*.mustache", "*/*.mustache"); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Add("card", "[{{>emails/footer}}]"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(set.Names(), ","); got != "card,emails/footer,layout,page" {
+		t.Fatalf("names: %s", got)
+	}
+	out, err := set.Render("page", map[string]any{"name": "Ann"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "<title>Ann</title>Bye Ann" {
+		t.Fatalf("got %q", out)
+	}
+	if set.Lookup("card") == nil || set.Lookup("nope") != nil {
+		t.Fatal("Lookup")
+	}
+	if _, err := set.Render("nope", nil); !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("expected ErrTemplateNotFound, got %v", err)
+	}
+
+	// replacing a partial affects the templates using it
+	if err := set.Add("emails/footer", "Ciao {{name}}"); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := set.Render("card", map[string]any{"name": "Bo"}); out != "[Ciao Bo]" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestSetValidatesReferences(t *testing.T) {
+	set := NewSet(WithPartials(MapPartials{"external": "x"}))
+	err := set.AddMap(map[string]string{
+		"a": "{{>b}}{{>external}}{{>*dynamic}}",
+		"b": "{{#s}}\n  {{>missing}}{{/s}}{{<gone}}{{/gone}}",
+	})
+	var missing *MissingPartialError
+	if !errors.As(err, &missing) {
+		t.Fatalf("expected *MissingPartialError, got %v", err)
+	}
+	if want := "b:2:3: missing partial \"missing\"\nb:2:21: missing partial \"gone\""; err.Error() != want {
+		t.Fatalf("got %q want %q", err.Error(), want)
+	}
+	if len(set.Names()) != 0 {
+		t.Fatalf("templates added despite errors: %v", set.Names())
+	}
+	var perr *ParseError
+	if err := set.Add("bad", "{{#x}}"); !errors.As(err, &perr) || perr.Name != "bad" {
+		t.Fatalf("expected *ParseError for bad, got %v", err)
+	}
+	if err := set.Add("b", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Add("a", "{{>b}}{{>external}}"); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := set.Render("a", nil); err != nil || out != "bx" {
+		t.Fatalf("got %q, %v", out, err)
+	}
+}
+
+func TestSetConcurrent(t *testing.T) {
+	set := NewSet()
+	if err := set.AddMap(map[string]string{"row": "<{{.}}>", "list": "{{#items}}{{>row}}{{/items}}"}); err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]any{"items": []any{1, 2, 3}}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				out, err := set.Render("list", data)
+				if err != nil || (out != "<1><2><3>" && out != "(1)(2)(3)") {
+					t.Errorf("got %q, %v", out, err)
+					return
+				}
+			}
+		}()
+	}
+	if err := set.Add("row", "({{.}})"); err != nil {
+		t.Error(err)
+	}
+	wg.Wait()
+}
@@ -22,6 +22,12 @@ type specCase struct {
 	Expected    string            `json:"expected"`
 }
 
+// optionalSpecs lists the optional spec modules that are run.
+var optionalSpecs = map[string]bool{
+	"~dynamic-names.json": true,
+	"~inheritance.json":   true,
+}
+
 func TestMustacheSpecJSON(t *testing.T) {
 	specsDir := "spec/specs"
 	entries, err := os.ReadDir(specsDir)
@@ -39,11 +45,8 @@ func TestMustacheSpecJSON(t *testing.T) {
 		if !strings.HasSuffix(name, ".json") {
 			continue
 		}
-		// Skip optional (~*) and inheritance module for now
-		if strings.HasPrefix(name, "~") {
-			continue
-		}
-		if strings.Contains(strings.ToLower(name), "inheritance") {
+		// Skip optional modules (~*) that are not implemented
+		if strings.HasPrefix(name, "~") && !optionalSpecs[name] {
 			continue
 		}
 		path := filepath.Join(specsDir, name)
@@ -0,0 +1,60 @@
+package mustachio
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type chunkWriter struct{ chunks []string }
+
+func (c *chunkWriter) Write(b []byte) (int, error) {
+	c.chunks = append(c.chunks, string(b))
+	return len(b), nil
+}
+
+func TestExecuteStreamsChunks(t *testing.T) {
+	var seen []string
+	cw := &chunkWriter{}
+	data := map[string]any{
+		"name": "<Willy>",
+		"wrap": func(text string) string {
+			// everything before the section must already have been written
+			seen = append(seen, strings.Join(cw.chunks, ""))
+			return "[" + text + "]"
+		},
+		"team":  "ops",
+		"title": func() string { return "{{team}} & co" },
+	}
+	err := Execute(cw, "head {{#wrap}}{{name}}{{/wrap}} {{title}}", data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(cw.chunks, ""); got != "head [&lt;Willy&gt;] ops &amp; co" {
+		t.Fatalf("got %q", got)
+	}
+	if len(seen) != 1 || seen[0] != "head " {
+		t.Fatalf("section lambda ran before preceding output was written: %q", seen)
+	}
+}
+
+type failingWriter struct{ n int }
+
+func (f *failingWriter) Write(b []byte) (int, error) {
+	if f.n <= 0 {
+		return 0, errors.New("closed pipe")
+	}
+	f.n--
+	return len(b), nil
+}
+
+func TestExecuteWriterError(t *testing.T) {
+	tpl, err := Compile("a{{#items}}{{.}}{{/items}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tpl.Execute(&failingWriter{n: 2}, map[string]any{"items": []any{1, 2, 3}})
+	if err == nil || err.Error() != "closed pipe" {
+		t.Fatalf("got %v", err)
+	}
+}
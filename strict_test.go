@@ -0,0 +1,90 @@
+package mustachio
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStrictMissingVariable(t *testing.T) {
+	tpl, err := Compile("Hi\n{{#user}}  {{address.city}}{{/user}}", WithStrict(), WithName("mail"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]any{"user": map[string]any{"address": map[string]any{"zip": "1"}}}
+	_, err = tpl.Render(data)
+	var mk *MissingKeyError
+	if !errors.As(err, &mk) {
+		t.Fatalf("expected *MissingKeyError, got %v", err)
+	}
+	if mk.Template != "mail" || mk.Name != "address.city" || mk.Segment != "city" || mk.Line != 2 || mk.Column != 12 || mk.Depth != 2 {
+		t.Fatalf("unexpected error fields: %#v", mk)
+	}
+	if err.Error() != `mail:2:12: missing key "address.city" ("city" not found)` {
+		t.Fatalf("got %q", err.Error())
+	}
+}
+
+func TestStrictMissingSection(t *testing.T) {
+	for _, src := range []string{"{{#items}}x{{/items}}", "{{^items}}x{{/items}}", "{{>*kind}}"} {
+		tpl, err := Compile(src, WithStrict())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tpl.Render(map[string]any{})
+		var mk *MissingKeyError
+		if !errors.As(err, &mk) || mk.Segment != mk.Name {
+			t.Fatalf("%s: got %v", src, err)
+		}
+	}
+}
+
+func TestStrictAllowsNilAndFalsey(t *testing.T) {
+	tpl, err := Compile("[{{a}}{{^b}}no{{/b}}{{#c}}x{{/c}}]", WithStrict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tpl.Render(map[string]any{"a": nil, "b": false, "c": []any{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "[no]" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestStrictPartials(t *testing.T) {
+	src := "{{> header}}\n  {{> footer}}"
+	out, err := Render(src, nil, MapPartials{"header": "H"})
+	if err != nil || out != "H" {
+		t.Fatalf("default mode: got %q, %v", out, err)
+	}
+	tpl, err := Compile(src, WithPartials(MapPartials{"header": "H"}), WithStrictPartials())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Render(nil)
+	var mp *MissingPartialError
+	if !errors.As(err, &mp) || mp.Name != "footer" || mp.Line != 2 || mp.Column != 3 {
+		t.Fatalf("got %v", err)
+	}
+	// missing variables are still allowed without WithStrict
+	tpl, err = Compile("{{> header}}{{nope}}", WithPartials(MapPartials{"header": "{{x}}"}), WithStrictPartials())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpl.Render(nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStrictErrorInPartialNamesPartial(t *testing.T) {
+	tpl, err := Compile("{{> row}}", WithPartials(MapPartials{"row": "{{id}}"}), WithStrict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Render(map[string]any{})
+	var mk *MissingKeyError
+	if !errors.As(err, &mk) || mk.Template != "row" {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package mustachio
+
+import (
+	"errors"
+	"testing"
+)
+
+type testAddress struct {
+	City string `json:"city"`
+}
+
+type testPerson struct {
+	*testAddress
+	First    string `mustache:"first"`
+	Last     string `json:"last_name,omitempty"`
+	Secret   string `json:"-"`
+	Nickname string
+	Friends  []any
+	hidden   string
+}
+
+func (p testPerson) FullName() string { return p.First + " " + p.Last }
+
+func (p *testPerson) Initials() string { return p.First[:1] + p.Last[:1] }
+
+func (a testAddress) Label() string { return "in " + a.City }
+
+type testShadow struct {
+	*testAddress
+}
+
+func (testShadow) Label() string { return "own" }
+
+type testPanicky struct{}
+
+func (testPanicky) Boom() string { panic("boom") }
+
+type testAccount struct {
+	Owner *testPerson `json:"owner"`
+	ID    int
+}
+
+func TestStructFieldsAndTags(t *testing.T) {
+	p := testPerson{First: "Ada", Last: "Lovelace", Secret: "x", Nickname: "Countess", hidden: "h"}
+	tpl := "{{first}} {{last_name}} ({{Nickname}}) [{{Secret}}{{hidden}}{{First}}]"
+	out, err := Render(tpl, p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "Ada Lovelace (Countess) [Ada]" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestStructEmbeddingPointersAndMethods(t *testing.T) {
+	acct := &testAccount{ID: 7, Owner: &testPerson{
+		testAddress: &testAddress{City: "London"},
+		First:       "Ada",
+		Last:        "Lovelace",
+	}}
+	tpl := "{{ID}}: {{owner.FullName}} {{owner.Initials}} from {{#owner}}{{city}}{{/owner}}"
+	out, err := Render(tpl, acct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "7: Ada Lovelace AL from London" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestStructNilPointers(t *testing.T) {
+	data := map[string]any{"acct": &testAccount{ID: 1}, "who": &testPerson{First: "Bob"}}
+	tpl := "[{{acct.owner.first}}]{{#acct.owner}}x{{/acct.owner}}{{^acct.owner}}none{{/acct.owner}}[{{who.city}}]"
+	out, err := Render(tpl, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "[]none[]" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestStructInList(t *testing.T) {
+	data := map[string]any{"people": []any{testPerson{First: "A"}, &testPerson{First: "B"}}}
+	out, err := Render("{{#people}}{{first}};{{/people}}", data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "A;B;" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestStructNilEmbeddedMethods(t *testing.T) {
+	data := map[string]any{
+		"bare":   testPerson{First: "A"},
+		"ptr":    &testPerson{First: "B"},
+		"full":   testPerson{testAddress: &testAddress{City: "Paris"}},
+		"shadow": testShadow{},
+	}
+	out, err := Render("[{{bare.Label}}][{{ptr.Label}}][{{full.Label}}][{{shadow.Label}}]{{^bare.Label}}missing{{/bare.Label}}", data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "[][][in Paris][own]missing" {
+		t.Fatalf("got %q", out)
+	}
+
+	tpl, err := Compile("{{bare.Label}}", WithStrict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var missing *MissingKeyError
+	if _, err := tpl.Render(data); !errors.As(err, &missing) {
+		t.Fatalf("expected *MissingKeyError, got %v", err)
+	}
+}
+
+func TestStructMethodPanic(t *testing.T) {
+	tpl, err := Compile("x\n {{p.Boom}}", WithName("t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Render(map[string]any{"p": testPanicky{}})
+	var lerr *LambdaError
+	if !errors.As(err, &lerr) || lerr.Panic != "boom" {
+		t.Fatalf("expected *LambdaError, got %v", err)
+	}
+	if want := `t:2:2: lambda "p.Boom" panicked: boom`; err.Error() != want {
+		t.Errorf("got %q want %q", err.Error(), want)
+	}
+}
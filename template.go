@@ -0,0 +1,213 @@
+package mustachio
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Template is a compiled Mustache template. It is produced once by Compile
+// and can then be rendered any number of times without re-parsing.
+//
+// A Template is immutable after compilation and safe for concurrent use by
+// multiple goroutines.
+type Template struct {
+	name     string
+	root     *rootNode
+	partials PartialLoaderContext
+	delims   delimiters
+
+	escape         Escaper
+	escapeChunks   bool
+	contextual     bool
+	strict         bool
+	strictPartials bool
+	limits         Limits
+	memoize        bool
+}
+
+// Option configures a Template at compile time.
+type Option func(*Template)
+
+// WithName sets the name of the template. The name is used to identify the
+// template in error messages.
+func WithName(name string) Option {
+	return func(t *Template) { t.name = name }
+}
+
+// WithPartials sets the loader used to resolve {{> name}} tags while rendering.
+func WithPartials(partials PartialLoader) Option {
+	return func(t *Template) {
+		t.partials = nil
+		if partials != nil {
+			t.partials = AdaptPartialLoader(partials)
+		}
+	}
+}
+
+// WithPartialsContext sets a loader used to resolve {{> name}} tags while
+// rendering that can fail. Its errors, other than ErrPartialNotFound, abort
+// the render with a *PartialError.
+func WithPartialsContext(partials PartialLoaderContext) Option {
+	return func(t *Template) { t.partials = partials }
+}
+
+// WithDelimiters sets the initial opening and closing tag delimiters.
+// The template may still change them with a set-delimiter tag.
+func WithDelimiters(otag, ctag string) Option {
+	return func(t *Template) { t.delims = delimiters{otag: otag, ctag: ctag} }
+}
+
+// WithStrict makes rendering fail with a *MissingKeyError when a variable or
+// section name (including the name of a dynamic partial) cannot be resolved,
+// instead of rendering nothing as the spec requires. A name that resolves to a
+// nil value is not missing.
+func WithStrict() Option {
+	return func(t *Template) { t.strict = true }
+}
+
+// WithStrictPartials makes rendering fail with a *MissingPartialError when a
+// partial or parent cannot be loaded, instead of rendering nothing.
+func WithStrictPartials() Option {
+	return func(t *Template) { t.strictPartials = true }
+}
+
+// WithMemoize makes each render remember the values it looks up, per context
+// frame and name, so lazy values and struct methods used several times are
+// called once. See NewMemoMapProvider.
+func WithMemoize() Option {
+	return func(t *Template) { t.memoize = true }
+}
+
+// WithLimits bounds the resources each render of the template may use.
+// Exceeding a limit fails the render with a *LimitError.
+func WithLimits(limits Limits) Option {
+	return func(t *Template) { t.limits = limits }
+}
+
+// WithEscapeMode selects one of the built-in escapers for {{name}} tags.
+// The default is EscapeHTML. {{{name}}} and {{& name}} are never escaped.
+func WithEscapeMode(mode EscapeMode) Option {
+	return func(t *Template) {
+		t.escape = mode.Escaper()
+		t.escapeChunks = mode != EscapeCSV && mode != EscapeShell
+		t.contextual = mode == EscapeHTMLContextual
+	}
+}
+
+// WithEscaper sets a custom escaper for {{name}} tags. It is always called
+// with complete values.
+func WithEscaper(escape Escaper) Option {
+	return func(t *Template) {
+		t.escape = escape
+		t.escapeChunks = false
+		t.contextual = false
+	}
+}
+
+// Compile parses a template source once into a reusable Template.
+func Compile(src string, opts ...Option) (*Template, error) {
+	t := &Template{delims: delimiters{otag: "{{", ctag: "}}"}, escape: escapeHTMLSpec, escapeChunks: true}
+	for _, opt := range opts {
+		opt(t)
+	}
+	root, err := Parse(src, t.delims)
+	if err == nil && t.contextual {
+		// unlike partials, a template may end in any state
+		_, err = contextualize(src, root.children, htmlState{})
+	}
+	if err != nil {
+		var perr *ParseError
+		if errors.As(err, &perr) {
+			perr.Name = t.name
+		}
+		return nil, err
+	}
+	t.root = root
+	return t, nil
+}
+
+// Name returns the name the template was compiled with.
+func (t *Template) Name() string { return t.name }
+
+// Render renders the template with the given data and returns the result.
+func (t *Template) Render(data any) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// RenderProvider renders the template against a custom ValueProvider and
+// returns the result.
+func (t *Template) RenderProvider(p ValueProvider) (string, error) {
+	var b strings.Builder
+	if err := t.ExecuteProvider(&b, p); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// ExecuteProvider renders the template against a custom ValueProvider and
+// writes the result to w. Every name lookup of the render, including those in
+// sections, partials and lambdas, goes through p, and sections enter new
+// contexts with p.Push.
+func (t *Template) ExecuteProvider(w io.Writer, p ValueProvider) error {
+	return t.ExecuteProviderContext(context.Background(), w, p)
+}
+
+// ExecuteProviderContext is like ExecuteProvider, but stops with ctx.Err()
+// once ctx is done.
+func (t *Template) ExecuteProviderContext(ctx context.Context, w io.Writer, p ValueProvider) error {
+	st := t.newState(ctx)
+	return t.root.render(st.limitOutput(w), p, st)
+}
+
+// Execute renders the template with the given data and writes the result to w
+// as it is produced. Nothing is buffered, except the text a two-argument
+// section lambda hands to its render callback.
+func (t *Template) Execute(w io.Writer, data any) error {
+	return t.ExecuteContext(context.Background(), w, data)
+}
+
+// ExecuteContext is like Execute, but stops with ctx.Err() once ctx is done.
+// Cancellation is checked between nodes and list items; ctx is also passed
+// to lambdas that take a context.Context as their first argument and to
+// PartialLoaderContext loaders.
+func (t *Template) ExecuteContext(ctx context.Context, w io.Writer, data any) error {
+	if t.memoize {
+		return t.ExecuteProviderContext(ctx, w, NewMemoMapProvider(toAnyMap(data)))
+	}
+	return t.ExecuteProviderContext(ctx, w, NewMapProvider(toAnyMap(data)))
+}
+
+// RenderContext is like Render, but stops with ctx.Err() once ctx is done.
+func (t *Template) RenderContext(ctx context.Context, data any) (string, error) {
+	var b strings.Builder
+	if err := t.ExecuteContext(ctx, &b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (t *Template) newState(ctx context.Context) *renderState {
+	var chain []string
+	if t.name != "" {
+		chain = []string{t.name}
+	}
+	return &renderState{
+		name:           t.name,
+		chain:          chain,
+		ctx:            ctx,
+		done:           ctx.Done(),
+		partials:       t.partials,
+		delims:         t.delims,
+		escape:         t.escape,
+		escapeChunks:   t.escapeChunks,
+		strict:         t.strict,
+		strictPartials: t.strictPartials,
+		limits:         newLimiter(t.limits),
+	}
+}
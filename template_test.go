@@ -0,0 +1,79 @@
+package mustachio
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCompileRenderMany(t *testing.T) {
+	tpl, err := Compile("Hello {{name}}! {{> sig}}", WithPartials(MapPartials{"sig": "-- {{team}}"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		out, err := tpl.Render(map[string]any{"name": name, "team": "ops"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "Hello " + name + "! -- ops"; out != want {
+			t.Fatalf("got %q want %q", out, want)
+		}
+	}
+}
+
+func TestTemplateExecute(t *testing.T) {
+	tpl, err := Compile("{{#items}}[{{.}}]{{/items}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, map[string]any{"items": []any{"<a>", "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[&lt;a&gt;][b]" {
+		t.Fatalf("got %q", buf.String())
+	}
+}
+
+func TestCompileWithDelimiters(t *testing.T) {
+	tpl, err := Compile("<% greeting %>, {{name}}", WithDelimiters("<%", "%>"), WithName("greet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpl.Name() != "greet" {
+		t.Fatalf("got name %q", tpl.Name())
+	}
+	out, err := tpl.Render(map[string]any{"greeting": "Hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "Hi, {{name}}" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestTemplateConcurrentRender(t *testing.T) {
+	tpl, err := Compile("{{#rows}}{{id}},{{/rows}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rows := []any{map[string]any{"id": i}, map[string]any{"id": i + 1}}
+			out, err := tpl.Render(map[string]any{"rows": rows})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if want := fmt.Sprintf("%d,%d,", i, i+1); out != want {
+				t.Errorf("got %q want %q", out, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
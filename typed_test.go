@@ -0,0 +1,66 @@
+package mustachio
+
+import "testing"
+
+type testUser struct {
+	Name string `json:"name"`
+}
+
+func TestTypedMapsAndSlices(t *testing.T) {
+	type key string
+	data := map[string]any{
+		"labels": map[string]string{"env": "prod"},
+		"counts": map[key]int{"hits": 3},
+		"tags":   []string{"a", "b"},
+		"users":  []testUser{{Name: "x"}, {Name: "y"}},
+		"grid":   [3]int{1, 2, 3},
+		"rows":   []map[string]any{{"id": 1}, {"id": 2}},
+	}
+	tpl := "{{labels.env}} {{counts.hits}} {{#tags}}{{.}}{{/tags}} {{#users}}{{name}}{{/users}} {{users.1.name}} {{#grid}}{{.}}{{/grid}} {{grid.2}} {{#rows}}{{id}}{{/rows}}"
+	out, err := Render(tpl, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "prod 3 ab xy y 123 3 12" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestTypedEmptyListsAreFalsey(t *testing.T) {
+	data := map[string]any{
+		"none":  []string{},
+		"zero":  [0]int{},
+		"empty": map[string]int{},
+		"bytes": []byte{},
+	}
+	tpl := "{{^none}}1{{/none}}{{^zero}}2{{/zero}}{{#empty}}3{{/empty}}{{^bytes}}4{{/bytes}}{{#bytes}}5{{/bytes}}"
+	out, err := Render(tpl, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "1234" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestTypedRootContext(t *testing.T) {
+	out, err := Render("{{greeting}}, {{0}}", map[string]string{"greeting": "hi", "0": "zero"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "hi, zero" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestIndexOverflow(t *testing.T) {
+	data := map[string]any{"a": []any{"first"}, "b": []string{"first"}, "c": [1]int{7}}
+	tpl := "[{{a.18446744073709551616}}][{{b.18446744073709551616}}][{{c.92233720368547758070}}][{{a.0}}]"
+	out, err := Render(tpl, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "[][][][first]" {
+		t.Fatalf("got %q", out)
+	}
+}